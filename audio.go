@@ -4,33 +4,77 @@ package reisen
 // #include <libavcodec/avcodec.h>
 // #include <libavformat/avformat.h>
 // #include <libavutil/avutil.h>
+// #include <libavutil/channel_layout.h>
 // #include <libswresample/swresample.h>
 import "C"
-import (
-	"fmt"
-	"unsafe"
-)
+import "unsafe"
 
 const (
-	// StandardChannelCount is used for
-	// audio conversion while decoding
-	// audio frames.
+	// StandardChannelCount is the number
+	// of channels of the default (stereo)
+	// channel layout of the decoded audio
+	// frames.
 	StandardChannelCount = 2
 )
 
+// AudioFormat is the format the audio
+// stream decodes the frames to.
+type AudioFormat struct {
+	// SampleFormat is the format of
+	// the samples, float64 by default.
+	SampleFormat SampleFormat
+	// SampleRate is the number of samples
+	// per second of one channel. The samples
+	// are resampled if it differs from the
+	// sample rate of the source, and 0 means
+	// the sample rate of the source.
+	SampleRate int
+	// ChannelLayout is the set of output
+	// channels, stereo by default. The
+	// native layout keeps the channels
+	// of the source intact.
+	ChannelLayout ChannelLayout
+	// Planar makes the samples of each
+	// channel be stored in a separate
+	// plane instead of interleaving them.
+	Planar bool
+}
+
 // AudioStream is a stream containing
 // audio frames consisting of audio samples.
 type AudioStream struct {
 	baseStream
-	swrCtx     *C.SwrContext
-	buffer     *C.uint8_t
-	bufferSize C.int
+	swrCtx           *C.SwrContext
+	format           AudioFormat
+	sampleRate       int
+	buffer           *C.uint8_t
+	bufferSize       C.int
+	srcSampleFormat  C.int
+	srcSampleRate    C.int
+	srcLayout        C.AVChannelLayout
+	outLayout        C.AVChannelLayout
+	layoutName       string
+	channelNames     []string
+	nextPTS          int64
+	resamplerFlushed bool
+	held             bool
 }
 
 // ChannelCount returns the number of channels
-// (1 for mono, 2 for stereo, etc.).
+// (1 for mono, 2 for stereo, 4 for first order
+// ambisonic, etc.).
 func (audio *AudioStream) ChannelCount() int {
-	return int(audio.codecParams.channels)
+	return int(audio.codecParams.ch_layout.nb_channels)
+}
+
+// ChannelLayout returns the description of
+// the channel layout of the audio stream,
+// e.g. "stereo", "5.1(side)" or "ambisonic 1".
+func (audio *AudioStream) ChannelLayout() string {
+	description, _ := describeChannels(
+		&audio.codecParams.ch_layout)
+
+	return description
 }
 
 // SampleRate returns the sample rate of the
@@ -46,68 +90,376 @@ func (audio *AudioStream) FrameSize() int {
 }
 
 // Open opens the audio stream to decode
-// audio frames and samples from it.
+// interleaved stereo float64 samples at
+// the sample rate of the source.
 func (audio *AudioStream) Open() error {
-	err := audio.open()
+	return audio.OpenDecode(AudioFormat{})
+}
+
+// OpenDecode opens the audio stream to decode
+// audio frames and samples of the specified
+// format from it.
+//
+// The options are passed to the decoder,
+// e.g. "threads" or "drc_scale".
+func (audio *AudioStream) OpenDecode(format AudioFormat, options ...Options) error {
+	if format.SampleFormat.av(format.Planar) == C.AV_SAMPLE_FMT_NONE {
+		return ErrorInvalidValue.wrap(
+			"couldn't use an unknown sample format")
+	}
+
+	if format.SampleRate < 0 {
+		return ErrorInvalidValue.wrap(
+			"couldn't use a negative sample rate")
+	}
+
+	if format.ChannelLayout == 0 {
+		format.ChannelLayout = ChannelLayoutStereo
+	}
+
+	err := audio.open(mergeOptions(options))
+
+	if err != nil {
+		return err
+	}
+
+	// The resampler is created when the first
+	// frame is decoded because the filter graph
+	// can change the format of the samples.
+	audio.format = format
+	audio.sampleRate = audio.outputRate(
+		int(audio.codecCtx.sample_rate))
+	audio.resamplerFlushed = false
+	audio.held = false
+
+	return nil
+}
+
+// Format returns the format the frames are
+// decoded to with the current sample rate
+// of the output frames.
+func (audio *AudioStream) Format() AudioFormat {
+	format := audio.format
+	format.SampleRate = audio.sampleRate
+
+	return format
+}
+
+// outputRate returns the sample rate of
+// the output frames for the source of the
+// specified sample rate.
+func (audio *AudioStream) outputRate(srcRate int) int {
+	if audio.format.SampleRate > 0 {
+		return audio.format.SampleRate
+	}
+
+	return srcRate
+}
+
+// SetFilterGraph makes the decoded frames go
+// through the libavfilter graph defined by the
+// description (e.g. "loudnorm" or "atempo=1.5")
+// before they are converted to the output
+// format. The empty description removes
+// the filter graph.
+func (audio *AudioStream) SetFilterGraph(description string) error {
+	return audio.setFilterGraph(description)
+}
+
+// FilterGraph returns the description of the
+// filter graph of the stream or "" if there's
+// no filter graph.
+func (audio *AudioStream) FilterGraph() string {
+	return audio.filterGraphDescription()
+}
+
+// resamplerMatches returns 'true' if the
+// SWR context is created for the format,
+// the sample rate and the channel layout
+// of the current frame.
+func (audio *AudioStream) resamplerMatches() bool {
+	frame := audio.frame
+
+	return audio.swrCtx != nil &&
+		frame.format == audio.srcSampleFormat &&
+		frame.sample_rate == audio.srcSampleRate &&
+		C.av_channel_layout_compare(&frame.ch_layout,
+			&audio.srcLayout) == 0
+}
+
+// updateResampler allocates the SWR context
+// to convert the current frame to the output
+// format if there's no one yet or the format
+// of the frame has changed.
+func (audio *AudioStream) updateResampler() error {
+	frame := audio.frame
+
+	if audio.resamplerMatches() {
+		return nil
+	}
+
+	var inLayout C.AVChannelLayout
+
+	status := C.av_channel_layout_copy(&inLayout, &frame.ch_layout)
+
+	if status < 0 {
+		return newAVError(status,
+			"couldn't copy the channel layout")
+	}
+
+	defer C.av_channel_layout_uninit(&inLayout)
+
+	// The channels of the unknown layout
+	// are treated as the default ones for
+	// their number.
+	if inLayout.order == C.AV_CHANNEL_ORDER_UNSPEC {
+		C.av_channel_layout_default(&inLayout,
+			frame.ch_layout.nb_channels)
+	}
+
+	err := audio.updateOutputLayout(&inLayout)
 
 	if err != nil {
 		return err
 	}
 
-	audio.swrCtx = C.swr_alloc_set_opts(nil,
-		C.AV_CH_FRONT_LEFT|C.AV_CH_FRONT_RIGHT,
-		C.AV_SAMPLE_FMT_DBL, audio.codecCtx.sample_rate,
-		channelLayout(audio), audio.
-			codecCtx.sample_fmt, audio.codecCtx.
-			sample_rate, 0, nil)
+	outRate := audio.outputRate(int(frame.sample_rate))
 
-	if audio.swrCtx == nil {
-		return fmt.Errorf(
+	C.swr_free(&audio.swrCtx)
+	status = C.swr_alloc_set_opts2(&audio.swrCtx,
+		&audio.outLayout, audio.format.SampleFormat.
+			av(audio.format.Planar), C.int(outRate),
+		&inLayout, C.enum_AVSampleFormat(frame.format),
+		frame.sample_rate, 0, nil)
+
+	if status < 0 {
+		return newAVError(status,
 			"couldn't allocate an SWR context")
 	}
 
-	status := C.swr_init(audio.swrCtx)
+	status = C.swr_init(audio.swrCtx)
+
+	if status < 0 {
+		C.swr_free(&audio.swrCtx)
+
+		return newAVError(status,
+			"couldn't initialize the SWR context")
+	}
+
+	C.av_channel_layout_uninit(&audio.srcLayout)
+	status = C.av_channel_layout_copy(
+		&audio.srcLayout, &frame.ch_layout)
 
 	if status < 0 {
-		return fmt.Errorf(
-			"%d: couldn't initialize the SWR context", status)
+		C.swr_free(&audio.swrCtx)
+
+		return newAVError(status,
+			"couldn't copy the channel layout")
 	}
 
-	audio.buffer = nil
+	audio.srcSampleFormat = frame.format
+	audio.srcSampleRate = frame.sample_rate
+	audio.sampleRate = outRate
+
+	return nil
+}
+
+// updateOutputLayout sets the channel layout of
+// the output frames for the source of the
+// specified layout.
+func (audio *AudioStream) updateOutputLayout(inLayout *C.AVChannelLayout) error {
+	var status C.int
+
+	C.av_channel_layout_uninit(&audio.outLayout)
+
+	if audio.format.ChannelLayout == ChannelLayoutNative {
+		status = C.av_channel_layout_copy(
+			&audio.outLayout, inLayout)
+	} else {
+		status = C.av_channel_layout_from_mask(&audio.outLayout,
+			C.uint64_t(audio.format.ChannelLayout))
+	}
+
+	if status < 0 {
+		return newAVError(status,
+			"couldn't set the output channel layout")
+	}
+
+	audio.layoutName, audio.channelNames =
+		describeChannels(&audio.outLayout)
 
 	return nil
 }
 
 // ReadFrame reads a new frame from the stream.
 func (audio *AudioStream) ReadFrame() (Frame, bool, error) {
-	return audio.ReadAudioFrame()
+	frame, ok, err := audio.ReadAudioFrame()
+
+	if frame == nil {
+		return nil, ok, err
+	}
+
+	return frame, ok, err
+}
+
+// Flush drains the audio decoder and returns
+// the frames left in it after the end of the
+// media has been reached.
+func (audio *AudioStream) Flush() ([]Frame, error) {
+	return audio.flush(audio.ReadFrame)
 }
 
 // ReadAudioFrame reads a new audio frame from the stream.
 func (audio *AudioStream) ReadAudioFrame() (*AudioFrame, bool, error) {
-	ok, err := audio.read()
+	// The frame held back is
+	// converted at this time.
+	if !audio.held {
+		ok, err := audio.read()
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		if ok && audio.skip {
+			return nil, true, nil
+		}
+
+		// No more data except the samples
+		// buffered inside the resampler.
+		if !ok {
+			return audio.flushResampler()
+		}
+	}
+
+	audio.held = false
+
+	// The samples left in the old resampler
+	// come before the frame of the new format,
+	// so the frame is held back until the
+	// next call.
+	if audio.swrCtx != nil && !audio.resamplerMatches() {
+		frame, err := audio.drainResampler()
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		C.swr_free(&audio.swrCtx)
+
+		if frame != nil {
+			audio.held = true
+			return frame, true, nil
+		}
+	}
+
+	err := audio.updateResampler()
 
 	if err != nil {
 		return nil, false, err
 	}
 
-	if ok && audio.skip {
-		return nil, true, nil
+	data, err := audio.convert(audio.frame.extended_data,
+		audio.frame.nb_samples)
+
+	if err != nil {
+		return nil, false, err
 	}
 
-	// No more data.
-	if !ok {
+	pts := audio.frameTimestamp()
+	duration := int64(audio.frame.duration)
+	audio.nextPTS = NoTimestamp
+
+	if pts != NoTimestamp && duration > 0 {
+		audio.nextPTS = pts + duration
+	}
+
+	indCoded, indDisplay := audio.pictureNumbers()
+	frame := newAudioFrame(audio, pts, duration,
+		indCoded, indDisplay, audio.Format(), data)
+	frame.layout = audio.layoutName
+	frame.channels = audio.channelNames
+
+	return frame, true, nil
+}
+
+// flushResampler returns the frame of the samples
+// left in the resampler after the last decoded
+// frame. It's obtained only once.
+func (audio *AudioStream) flushResampler() (*AudioFrame, bool, error) {
+	if audio.swrCtx == nil || audio.resamplerFlushed {
 		return nil, false, nil
 	}
 
-	maxBufferSize := C.av_samples_get_buffer_size(
-		nil, StandardChannelCount,
-		audio.frame.nb_samples,
-		C.AV_SAMPLE_FMT_DBL, 1)
+	audio.resamplerFlushed = true
+	frame, err := audio.drainResampler()
+
+	if err != nil || frame == nil {
+		return nil, false, err
+	}
+
+	return frame, true, nil
+}
+
+// drainResampler returns the frame of the samples
+// left in the resampler or nil if there are none.
+// The resampler delays the samples, so they start
+// before the end of the last converted frame.
+func (audio *AudioStream) drainResampler() (*AudioFrame, error) {
+	pts := audio.nextPTS
+
+	if pts != NoTimestamp {
+		delay := C.swr_get_delay(audio.swrCtx,
+			C.int64_t(audio.sampleRate))
+		pts -= Rational{Num: 1, Den: audio.sampleRate}.
+			Rescale(int64(delay), audio.TimeBaseRational())
+	}
+
+	data, err := audio.convert(nil, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	frame := newAudioFrame(audio, pts,
+		0, 0, 0, audio.Format(), data)
+	frame.layout = audio.layoutName
+	frame.channels = audio.channelNames
+
+	return frame, nil
+}
+
+// convert converts the samples to the output
+// format with the resampler and returns them.
+// No input samples flush the resampler.
+//
+// The planes of the planar format go
+// one after another in the output.
+func (audio *AudioStream) convert(in **C.uint8_t, inSamples C.int) ([]byte, error) {
+	outSamples := C.swr_get_out_samples(
+		audio.swrCtx, inSamples)
+
+	if outSamples < 0 {
+		return nil, newAVError(outSamples,
+			"couldn't get the number of output samples")
+	}
+
+	if outSamples == 0 {
+		return []byte{}, nil
+	}
+
+	channels := audio.outLayout.nb_channels
+	sampleFormat := audio.format.SampleFormat.
+		av(audio.format.Planar)
+	maxBufferSize := C.av_samples_get_buffer_size(nil,
+		channels, outSamples, sampleFormat, 1)
 
 	if maxBufferSize < 0 {
-		return nil, false, fmt.Errorf(
-			"%d: couldn't get the max buffer size", maxBufferSize)
+		return nil, newAVError(maxBufferSize,
+			"couldn't get the max buffer size")
 	}
 
 	if maxBufferSize > audio.bufferSize {
@@ -116,37 +468,67 @@ func (audio *AudioStream) ReadAudioFrame() (*AudioFrame, bool, error) {
 	}
 
 	if audio.buffer == nil {
-		audio.buffer = (*C.uint8_t)(unsafe.Pointer(
-			C.av_malloc(bufferSize(maxBufferSize))))
+		audio.buffer = (*C.uint8_t)(C.av_malloc(
+			C.size_t(maxBufferSize)))
 		audio.bufferSize = maxBufferSize
 
 		if audio.buffer == nil {
-			return nil, false, fmt.Errorf(
+			return nil, ErrorNoMemory.wrap(
 				"couldn't allocate an AV buffer")
 		}
 	}
 
+	planes := make([]*C.uint8_t, channels)
+	status := C.av_samples_fill_arrays(&planes[0], nil,
+		audio.buffer, channels, outSamples, sampleFormat, 1)
+
+	if status < 0 {
+		return nil, newAVError(status,
+			"couldn't fill the sample planes")
+	}
+
 	gotSamples := C.swr_convert(audio.swrCtx,
-		&audio.buffer, audio.frame.nb_samples,
-		&audio.frame.data[0], audio.frame.nb_samples)
+		&planes[0], outSamples, in, inSamples)
 
 	if gotSamples < 0 {
-		return nil, false, fmt.Errorf(
-			"%d: couldn't convert the audio frame", gotSamples)
+		return nil, newAVError(gotSamples,
+			"couldn't convert the audio frame")
 	}
 
-	data := C.GoBytes(unsafe.Pointer(
-		audio.buffer), maxBufferSize)
-	frame := newAudioFrame(audio,
-		int64(audio.frame.pts),
-		int(audio.frame.coded_picture_number),
-		int(audio.frame.display_picture_number), data)
+	sampleSize := audio.format.SampleFormat.Size()
 
-	return frame, true, nil
+	if !audio.format.Planar {
+		return C.GoBytes(unsafe.Pointer(audio.buffer),
+			gotSamples*channels*C.int(sampleSize)), nil
+	}
+
+	planeSize := int(gotSamples) * sampleSize
+	data := make([]byte, 0, planeSize*len(planes))
+
+	for _, plane := range planes {
+		data = append(data, unsafe.Slice(
+			(*byte)(unsafe.Pointer(plane)), planeSize)...)
+	}
+
+	return data, nil
+}
+
+// reset drops all the data buffered
+// for decoding after seeking.
+func (audio *AudioStream) reset() {
+	audio.baseStream.reset()
+
+	// The samples buffered inside the
+	// resampler are dropped with it.
+	C.swr_free(&audio.swrCtx)
+	audio.resamplerFlushed = false
+	audio.held = false
 }
 
 // Close closes the audio stream and
 // stops decoding audio frames.
+//
+// It's safe to call it several times.
 func (audio *AudioStream) Close() error {
 	err := audio.close()
 
@@ -156,8 +538,11 @@ func (audio *AudioStream) Close() error {
 
 	C.av_free(unsafe.Pointer(audio.buffer))
 	audio.buffer = nil
+	audio.bufferSize = 0
 	C.swr_free(&audio.swrCtx)
-	audio.swrCtx = nil
+	audio.held = false
+	C.av_channel_layout_uninit(&audio.srcLayout)
+	C.av_channel_layout_uninit(&audio.outLayout)
 
 	return nil
 }
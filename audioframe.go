@@ -1,25 +1,253 @@
 package reisen
 
+import (
+	"encoding/binary"
+	"math"
+	"time"
+	"unsafe"
+)
+
+// nativeEndian is the byte order of the
+// host swresample writes the samples in.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	value := uint16(1)
+
+	if *(*byte)(unsafe.Pointer(&value)) == 1 {
+		return binary.LittleEndian
+	}
+
+	return binary.BigEndian
+}()
+
 // AudioFrame is a data frame
 // obtained from an audio stream.
 type AudioFrame struct {
 	baseFrame
-	data []byte
+	data     []byte
+	format   AudioFormat
+	layout   string
+	channels []string
 }
 
 // Data returns a raw slice of
-// audio frame samples.
+// audio frame samples in the byte
+// order of the host.
+//
+// The samples of the planar format
+// are stored plane after plane, one
+// plane per channel.
 func (frame *AudioFrame) Data() []byte {
 	return frame.data
 }
 
+// Format returns the format
+// of the frame samples.
+func (frame *AudioFrame) Format() AudioFormat {
+	return frame.format
+}
+
+// ChannelCount returns the number
+// of channels of the frame.
+func (frame *AudioFrame) ChannelCount() int {
+	return len(frame.channels)
+}
+
+// ChannelLayout returns the description of
+// the channel layout of the frame, e.g.
+// "stereo" or "ambisonic 1".
+func (frame *AudioFrame) ChannelLayout() string {
+	return frame.layout
+}
+
+// ChannelName returns the name of the channel
+// with the specified index (e.g. "FL" or "AMBI0")
+// or "" if there's no such channel.
+func (frame *AudioFrame) ChannelName(i int) string {
+	if i < 0 || i >= len(frame.channels) {
+		return ""
+	}
+
+	return frame.channels[i]
+}
+
+// ChannelData returns the raw samples of the
+// channel with the specified index in the
+// sample format of the frame or nil if
+// there's no such channel.
+func (frame *AudioFrame) ChannelData(i int) []byte {
+	channels := len(frame.channels)
+	sampleSize := frame.format.SampleFormat.Size()
+
+	if i < 0 || i >= channels || sampleSize == 0 {
+		return nil
+	}
+
+	samples := len(frame.data) / (channels * sampleSize)
+
+	if frame.format.Planar {
+		planeSize := samples * sampleSize
+
+		return frame.data[i*planeSize : (i+1)*planeSize]
+	}
+
+	data := make([]byte, 0, samples*sampleSize)
+
+	for offset := i * sampleSize; offset < len(frame.data); offset += channels * sampleSize {
+		data = append(data, frame.data[offset:offset+sampleSize]...)
+	}
+
+	return data
+}
+
+// SampleCount returns the number of
+// samples of one channel of the frame.
+func (frame *AudioFrame) SampleCount() int {
+	sampleSize := frame.format.SampleFormat.Size()
+
+	if len(frame.channels) == 0 || sampleSize == 0 {
+		return 0
+	}
+
+	return len(frame.data) / (len(frame.channels) * sampleSize)
+}
+
+// SampleRate returns the number of samples
+// per second of one channel of the frame.
+func (frame *AudioFrame) SampleRate() int {
+	return frame.format.SampleRate
+}
+
+// Duration returns the duration of the frame
+// in the time base units of its stream. If the
+// decoder hasn't reported it, it's computed
+// from the number of samples.
+func (frame *AudioFrame) Duration() int64 {
+	if frame.duration > 0 || frame.format.SampleRate <= 0 {
+		return frame.duration
+	}
+
+	return Rational{Num: 1, Den: frame.format.SampleRate}.
+		Rescale(int64(frame.SampleCount()), frame.TimeBase())
+}
+
+// SampleDuration returns the time the
+// samples of the frame are played for.
+func (frame *AudioFrame) SampleDuration() time.Duration {
+	if frame.format.SampleRate <= 0 {
+		return 0
+	}
+
+	return time.Duration(frame.SampleCount()) *
+		time.Second / time.Duration(frame.format.SampleRate)
+}
+
+// Samples returns the samples of the frame as
+// stereo pairs in the range [-1, 1]. The only
+// channel of the mono frame is played on both
+// sides, and only the first two channels of
+// the frame with more channels are taken.
+func (frame *AudioFrame) Samples() [][2]float64 {
+	if len(frame.channels) == 0 {
+		return nil
+	}
+
+	right := 0
+
+	if len(frame.channels) > 1 {
+		right = 1
+	}
+
+	count := frame.SampleCount()
+	samples := make([][2]float64, count)
+
+	for i := range samples {
+		samples[i] = [2]float64{
+			frame.sample(i, 0, count),
+			frame.sample(i, right, count),
+		}
+	}
+
+	return samples
+}
+
+// Float32Interleaved returns the samples of
+// all the channels of the frame interleaved
+// and converted to float32 in the range [-1, 1].
+func (frame *AudioFrame) Float32Interleaved() []float32 {
+	channels := len(frame.channels)
+	count := frame.SampleCount()
+	samples := make([]float32, count*channels)
+
+	for i := range samples {
+		samples[i] = float32(frame.sample(
+			i/channels, i%channels, count))
+	}
+
+	return samples
+}
+
+// Channel returns the samples of the channel
+// with the specified index converted to float64
+// in the range [-1, 1] or nil if there's no
+// such channel.
+func (frame *AudioFrame) Channel(i int) []float64 {
+	if i < 0 || i >= len(frame.channels) {
+		return nil
+	}
+
+	count := frame.SampleCount()
+	samples := make([]float64, count)
+
+	for j := range samples {
+		samples[j] = frame.sample(j, i, count)
+	}
+
+	return samples
+}
+
+// sample returns the sample with the specified
+// index of the channel converted to float64.
+// The count is the number of samples of one
+// channel of the frame.
+func (frame *AudioFrame) sample(index, channel, count int) float64 {
+	sampleSize := frame.format.SampleFormat.Size()
+	offset := (index*len(frame.channels) + channel) * sampleSize
+
+	if frame.format.Planar {
+		offset = (channel*count + index) * sampleSize
+	}
+
+	data := frame.data[offset : offset+sampleSize]
+
+	switch frame.format.SampleFormat {
+	case SampleFormatF64:
+		return math.Float64frombits(
+			nativeEndian.Uint64(data))
+
+	case SampleFormatF32:
+		return float64(math.Float32frombits(
+			nativeEndian.Uint32(data)))
+
+	case SampleFormatS16:
+		return float64(int16(nativeEndian.Uint16(data))) / (1 << 15)
+
+	case SampleFormatS32:
+		return float64(int32(nativeEndian.Uint32(data))) / (1 << 31)
+
+	default:
+		return 0
+	}
+}
+
 // newAudioFrame returns a newly created audio frame.
-func newAudioFrame(stream Stream, pts int64, indCoded, indDisplay int, data []byte) *AudioFrame {
+func newAudioFrame(stream Stream, pts, duration int64, indCoded, indDisplay int, format AudioFormat, data []byte) *AudioFrame {
 	frame := new(AudioFrame)
 
 	frame.stream = stream
 	frame.pts = pts
+	frame.duration = duration
 	frame.data = data
+	frame.format = format
 	frame.indexCoded = indCoded
 	frame.indexDisplay = indDisplay
 
@@ -0,0 +1,149 @@
+package reisen
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// testChannels are the samples of the
+// channels of the test frames. They are
+// exactly representable in all the formats.
+var testChannels = [][]float64{
+	{0.5, -0.25, 0},
+	{-1, 0.75, 0.125},
+}
+
+// encodeSample returns the bytes of the
+// sample in the format in the byte order
+// of the host.
+func encodeSample(format SampleFormat, value float64) []byte {
+	data := make([]byte, format.Size())
+
+	switch format {
+	case SampleFormatF64:
+		nativeEndian.PutUint64(data, math.Float64bits(value))
+
+	case SampleFormatF32:
+		nativeEndian.PutUint32(data, math.Float32bits(float32(value)))
+
+	case SampleFormatS16:
+		nativeEndian.PutUint16(data, uint16(int16(value*(1<<15))))
+
+	case SampleFormatS32:
+		nativeEndian.PutUint32(data, uint32(int32(value*(1<<31))))
+	}
+
+	return data
+}
+
+// newTestAudioFrame returns a frame of the
+// samples of the channels in the format.
+func newTestAudioFrame(format SampleFormat, planar bool, channels [][]float64) *AudioFrame {
+	data := []byte{}
+
+	if planar {
+		for _, channel := range channels {
+			for _, value := range channel {
+				data = append(data, encodeSample(format, value)...)
+			}
+		}
+	} else {
+		for i := range channels[0] {
+			for _, channel := range channels {
+				data = append(data, encodeSample(format, channel[i])...)
+			}
+		}
+	}
+
+	names := make([]string, len(channels))
+
+	for i := range names {
+		names[i] = fmt.Sprintf("C%d", i)
+	}
+
+	return &AudioFrame{
+		data: data,
+		format: AudioFormat{
+			SampleFormat: format,
+			Planar:       planar,
+		},
+		channels: names,
+	}
+}
+
+func TestAudioFrameSamples(t *testing.T) {
+	formats := []SampleFormat{SampleFormatF64, SampleFormatF32,
+		SampleFormatS16, SampleFormatS32}
+
+	for _, format := range formats {
+		for _, planar := range []bool{false, true} {
+			name := fmt.Sprintf("%s planar %t", format, planar)
+
+			t.Run(name, func(t *testing.T) {
+				frame := newTestAudioFrame(format, planar, testChannels)
+
+				if count := frame.SampleCount(); count != 3 {
+					t.Fatalf("got %d samples, expected 3", count)
+				}
+
+				for i, channel := range testChannels {
+					if samples := frame.Channel(i); !reflect.DeepEqual(samples, channel) {
+						t.Errorf("got channel %d %v, expected %v", i, samples, channel)
+					}
+
+					expected := []byte{}
+
+					for _, value := range channel {
+						expected = append(expected, encodeSample(format, value)...)
+					}
+
+					if data := frame.ChannelData(i); !bytes.Equal(data, expected) {
+						t.Errorf("got channel %d data %v, expected %v", i, data, expected)
+					}
+				}
+
+				if frame.Channel(2) != nil || frame.Channel(-1) != nil ||
+					frame.ChannelData(2) != nil || frame.ChannelData(-1) != nil {
+					t.Error("got the samples of a missing channel")
+				}
+
+				interleaved := []float32{0.5, -1, -0.25, 0.75, 0, 0.125}
+
+				if samples := frame.Float32Interleaved(); !reflect.DeepEqual(samples, interleaved) {
+					t.Errorf("got interleaved %v, expected %v", samples, interleaved)
+				}
+
+				pairs := [][2]float64{{0.5, -1}, {-0.25, 0.75}, {0, 0.125}}
+
+				if samples := frame.Samples(); !reflect.DeepEqual(samples, pairs) {
+					t.Errorf("got pairs %v, expected %v", samples, pairs)
+				}
+			})
+		}
+	}
+}
+
+func TestAudioFrameMonoSamples(t *testing.T) {
+	frame := newTestAudioFrame(SampleFormatS16, true, testChannels[:1])
+	pairs := [][2]float64{{0.5, 0.5}, {-0.25, -0.25}, {0, 0}}
+
+	if samples := frame.Samples(); !reflect.DeepEqual(samples, pairs) {
+		t.Fatalf("got %v, expected %v", samples, pairs)
+	}
+}
+
+func TestAudioFrameUnknownFormat(t *testing.T) {
+	frame := newTestAudioFrame(SampleFormatS16, false, testChannels)
+	frame.format.SampleFormat = SampleFormat(-1)
+
+	if count := frame.SampleCount(); count != 0 {
+		t.Fatalf("got %d samples, expected 0", count)
+	}
+
+	if data := frame.ChannelData(0); data != nil {
+		t.Fatalf("got channel data %v, expected nil", data)
+	}
+}
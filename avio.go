@@ -0,0 +1,167 @@
+package reisen
+
+// #cgo pkg-config: libavformat libavutil
+// #include <stdint.h>
+// #include <stdlib.h>
+// #include <libavformat/avio.h>
+// #include <libavutil/mem.h>
+//
+// extern int goIORead(void *opaque, uint8_t *buf, int bufSize);
+// extern int64_t goIOSeek(void *opaque, int64_t offset, int whence);
+import "C"
+import (
+	"io"
+	"runtime/cgo"
+	"unsafe"
+)
+
+const (
+	// ioBufferSize is the size of the buffer
+	// libAV uses to read the data from a Go
+	// reader.
+	ioBufferSize = 32 * 1024
+	// errorIO is the libAV error code
+	// for an input/output failure.
+	errorIO = -5
+)
+
+// ioSource is a Go reader serving
+// the media data to libAV.
+type ioSource struct {
+	reader io.ReadSeeker
+}
+
+// size returns the total size of the source
+// without changing its current position.
+func (source *ioSource) size() (int64, error) {
+	current, err := source.reader.Seek(0, io.SeekCurrent)
+
+	if err != nil {
+		return 0, err
+	}
+
+	end, err := source.reader.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = source.reader.Seek(current, io.SeekStart)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return end, nil
+}
+
+// ioContext is a custom libAV I/O
+// context reading from a Go reader.
+type ioContext struct {
+	ctx    *C.AVIOContext
+	handle cgo.Handle
+	opaque unsafe.Pointer
+}
+
+// free releases the I/O context
+// and the reader handle.
+func (ioCtx *ioContext) free() {
+	// The buffer could have been
+	// reallocated by libAV, so the
+	// actual pointer must be freed.
+	C.av_freep(unsafe.Pointer(&ioCtx.ctx.buffer))
+	C.avio_context_free(&ioCtx.ctx)
+	ioCtx.ctx = nil
+
+	ioCtx.handle.Delete()
+	C.free(ioCtx.opaque)
+	ioCtx.opaque = nil
+}
+
+// newIOContext creates a new custom libAV
+// I/O context reading from the source.
+func newIOContext(reader io.ReadSeeker) (*ioContext, error) {
+	buffer := C.av_malloc(ioBufferSize)
+
+	if buffer == nil {
+		return nil, ErrorNoMemory.wrap(
+			"couldn't allocate an I/O buffer")
+	}
+
+	// libAV passes the opaque pointer back to
+	// the callbacks, so it must point to C memory
+	// holding the handle of the Go reader.
+	handle := cgo.NewHandle(&ioSource{reader: reader})
+	opaque := C.malloc(C.size_t(unsafe.Sizeof(handle)))
+	*(*cgo.Handle)(opaque) = handle
+
+	ctx := C.avio_alloc_context((*C.uchar)(buffer),
+		ioBufferSize, 0, opaque, (*[0]byte)(C.goIORead),
+		nil, (*[0]byte)(C.goIOSeek))
+
+	if ctx == nil {
+		C.av_free(buffer)
+		handle.Delete()
+		C.free(opaque)
+
+		return nil, ErrorNoMemory.wrap(
+			"couldn't allocate an I/O context")
+	}
+
+	ioCtx := &ioContext{
+		ctx:    ctx,
+		handle: handle,
+		opaque: opaque,
+	}
+
+	return ioCtx, nil
+}
+
+// sourceFromOpaque returns the Go reader
+// bound to the opaque pointer.
+func sourceFromOpaque(opaque unsafe.Pointer) *ioSource {
+	handle := *(*cgo.Handle)(opaque)
+
+	return handle.Value().(*ioSource)
+}
+
+//export goIORead
+func goIORead(opaque unsafe.Pointer, buf *C.uint8_t, bufSize C.int) C.int {
+	source := sourceFromOpaque(opaque)
+	data := unsafe.Slice((*byte)(unsafe.Pointer(buf)), int(bufSize))
+	n, err := io.ReadAtLeast(source.reader, data, 1)
+
+	if n > 0 {
+		return C.int(n)
+	}
+
+	if err == io.EOF {
+		return C.int(ErrorEndOfFile)
+	}
+
+	return errorIO
+}
+
+//export goIOSeek
+func goIOSeek(opaque unsafe.Pointer, offset C.int64_t, whence C.int) C.int64_t {
+	source := sourceFromOpaque(opaque)
+
+	if whence&C.AVSEEK_SIZE != 0 {
+		size, err := source.size()
+
+		if err != nil {
+			return errorIO
+		}
+
+		return C.int64_t(size)
+	}
+
+	pos, err := source.reader.Seek(int64(offset),
+		int(whence&^C.AVSEEK_FORCE))
+
+	if err != nil {
+		return errorIO
+	}
+
+	return C.int64_t(pos)
+}
@@ -0,0 +1,153 @@
+package reisen
+
+// #cgo pkg-config: libavcodec
+// #include <libavcodec/avcodec.h>
+// #include <libavcodec/bsf.h>
+import "C"
+
+// filterPacket sends the packet read last to the
+// bitstream filter of its stream and queues all
+// the packets the filter produces. The packet
+// read last is consumed.
+func (media *Media) filterPacket(stream Stream) error {
+	status := C.av_bsf_send_packet(
+		stream.filter(), media.packet)
+
+	if status < 0 {
+		C.av_packet_unref(media.packet)
+
+		return newAVError(status,
+			"couldn't send the packet to the filter")
+	}
+
+	return media.receiveFiltered(stream.Index(),
+		stream.filter(), stream.innerStream().time_base)
+}
+
+// receiveFiltered queues all the packets available
+// at the output of the bitstream filter for the
+// stream with the specified index. The timestamps
+// of the packets are converted to the time base
+// of the stream.
+func (media *Media) receiveFiltered(index int, filter *C.AVBSFContext, timeBase C.AVRational) error {
+	for {
+		packet := C.av_packet_alloc()
+
+		if packet == nil {
+			return ErrorNoMemory.wrap(
+				"couldn't allocate a packet for filtering out")
+		}
+
+		status := C.av_bsf_receive_packet(filter, packet)
+
+		if status < 0 {
+			C.av_packet_free(&packet)
+
+			// The filter needs more packets
+			// or it's depleted.
+			if status == C.int(ErrorAgain) ||
+				status == C.int(ErrorEndOfFile) {
+				return nil
+			}
+
+			return newAVError(status,
+				"couldn't receive the packet from the filter")
+		}
+
+		if C.av_cmp_q(filter.time_base_out, timeBase) != 0 {
+			C.av_packet_rescale_ts(packet,
+				filter.time_base_out, timeBase)
+		}
+
+		packet.stream_index = C.int(index)
+		media.filtered = append(media.filtered, packet)
+	}
+}
+
+// drainFilters signals the end of the media to
+// the bitstream filters of all the streams and
+// queues the packets left in them.
+func (media *Media) drainFilters() error {
+	if media.filtersDrained {
+		return nil
+	}
+
+	media.filtersDrained = true
+
+	for _, stream := range media.streams {
+		if stream.filter() == nil {
+			continue
+		}
+
+		status := C.av_bsf_send_packet(stream.filter(), nil)
+
+		if status < 0 && status != C.int(ErrorEndOfFile) {
+			return newAVError(status,
+				"couldn't flush the filter")
+		}
+
+		err := media.receiveFiltered(stream.Index(),
+			stream.filter(), stream.innerStream().time_base)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// popFiltered makes the oldest
+// filtered packet the pending one.
+func (media *Media) popFiltered() {
+	packet := media.filtered[0]
+	media.filtered[0] = nil
+	media.filtered = media.filtered[1:]
+
+	C.av_packet_move_ref(media.packet, packet)
+	C.av_packet_free(&packet)
+	media.pending = true
+}
+
+// discardFiltered frees all the filtered
+// packets not read yet.
+func (media *Media) discardFiltered() {
+	for i := range media.filtered {
+		C.av_packet_free(&media.filtered[i])
+	}
+
+	media.filtered = nil
+	media.filtersDrained = false
+}
+
+// drainFilter signals the end of the stream to
+// its bitstream filter and queues the packets
+// left in it, so they are not lost when the
+// filter is replaced.
+func (stream *baseStream) drainFilter() error {
+	if stream.filterCtx == nil || stream.media.filtersDrained {
+		return nil
+	}
+
+	status := C.av_bsf_send_packet(stream.filterCtx, nil)
+
+	if status < 0 && status != C.int(ErrorEndOfFile) {
+		return newAVError(status,
+			"couldn't flush the filter")
+	}
+
+	return stream.media.receiveFiltered(stream.Index(),
+		stream.filterCtx, stream.inner.time_base)
+}
+
+// decoderParams returns the codec parameters
+// the decoder of the stream should be opened
+// with, i.e. the output parameters of the
+// bitstream filter if there's one.
+func (stream *baseStream) decoderParams() *C.AVCodecParameters {
+	if stream.filterCtx != nil {
+		return stream.filterCtx.par_out
+	}
+
+	return stream.codecParams
+}
@@ -1,11 +1,11 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
+	"context"
 	"fmt"
 	"image"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/faiface/beep"
@@ -16,12 +16,10 @@ import (
 )
 
 const (
-	frameBufferSize                   = 1024 * 1024
-	sampleRate                        = 48000
-	channelCount                      = 2
-	bitDepth                          = 8
-	sampleBufferSize                  = 32 * channelCount * bitDepth * 1024 * 1000
-	SpeakerSampleRate beep.SampleRate = 48000
+	frameBufferSize                   = 64
+	sampleRate                        = 44100
+	sampleBufferSize                  = 2 * sampleRate
+	SpeakerSampleRate beep.SampleRate = sampleRate
 )
 
 var totalVideoDecoded = 0
@@ -34,12 +32,11 @@ type videoWithSync struct {
 // readVideoAndAudio reads video and audio frames
 // from the opened media and sends the decoded
 // data to che channels to be played.
-func readVideoAndAudio(media *reisen.Media) (<-chan videoWithSync, <-chan [2]float64, <-chan *reisen.DataFrame, chan error, error) {
+func readVideoAndAudio(media *reisen.Media) (<-chan videoWithSync, <-chan [2]float64, <-chan *reisen.DataFrame, <-chan error, error) {
 	frameBuffer := make(chan videoWithSync,
 		frameBufferSize)
 	sampleBuffer := make(chan [2]float64, sampleBufferSize)
 	dataFrame := make(chan *reisen.DataFrame, frameBufferSize)
-	errs := make(chan error)
 
 	err := media.OpenDecode()
 
@@ -54,8 +51,12 @@ func readVideoAndAudio(media *reisen.Media) (<-chan videoWithSync, <-chan [2]flo
 		return nil, nil, nil, nil, err
 	}
 
+	// Resample the audio to
+	// the rate of the speaker.
 	audioStream := media.AudioStreams()[0]
-	err = audioStream.Open()
+	err = audioStream.OpenDecode(reisen.AudioFormat{
+		SampleRate: sampleRate,
+	})
 
 	if err != nil {
 		return nil, nil, nil, nil, err
@@ -69,6 +70,13 @@ func readVideoAndAudio(media *reisen.Media) (<-chan videoWithSync, <-chan [2]flo
 
 	fmt.Printf("# of streams: %d\n", len(media.Streams()))
 
+	pipeline, err := reisen.NewPipeline(context.Background(),
+		media, frameBufferSize, videoStream, audioStream, gmpdDataStream)
+
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
 	// Display some decoding statistics
 	stopStat := false
 	go func() {
@@ -84,135 +92,66 @@ func readVideoAndAudio(media *reisen.Media) (<-chan videoWithSync, <-chan [2]flo
 		}
 	}()
 
+	var wg sync.WaitGroup
+	wg.Add(3)
+	fmt.Println("*** START DECODER ***")
+
 	go func() {
-		fmt.Println("*** START DECODER ***")
-		for {
-			packet, gotPacket, err := media.ReadPacket()
+		defer wg.Done()
+		defer close(frameBuffer)
 
-			if err != nil {
-				go func(err error) {
-					fmt.Printf("media.ReadPacket: Error to the chan: %v\n", err)
-					errs <- err
-				}(err)
-			}
+		for frame := range pipeline.Frames(videoStream) {
+			videoFrame := frame.(*reisen.VideoFrame)
+			totalVideoDecoded++
 
-			if !gotPacket {
-				break
+			frameBuffer <- videoWithSync{
+				imgData: videoFrame.Image().(*image.RGBA),
+				pts:     videoFrame.PresentationOffsetOrDie(),
 			}
+		}
+	}()
 
-			switch packet.Type() {
-			case reisen.StreamVideo:
-				s := media.Streams()[packet.StreamIndex()].(*reisen.VideoStream)
-				videoFrame, gotFrame, err := s.ReadVideoFrame()
-
-				if err != nil {
-					go func(err error) {
-						fmt.Printf("StreamVideo: Error to the chan: %v (supressed)\n", err)
-						//errs <- err
-					}(err)
-				}
-
-				if !gotFrame {
-					break
-				}
-
-				if videoFrame == nil {
-					continue
-				}
-				totalVideoDecoded++
-
-				frameBuffer <- videoWithSync{
-					imgData: videoFrame.Image(),
-					pts:     videoFrame.PresentationOffsetOrDie(),
-				}
-
-			case reisen.StreamAudio:
-				s := media.Streams()[packet.StreamIndex()].(*reisen.AudioStream)
-				audioFrame, gotFrame, err := s.ReadAudioFrame()
-
-				if err != nil {
-					go func(err error) {
-						fmt.Printf("StreamAudio.1: Error to the chan: %v (supressed)\n", err)
-						//errs <- err
-					}(err)
-				}
-
-				if !gotFrame {
-					break
-				}
+	go func() {
+		defer wg.Done()
+		defer close(sampleBuffer)
 
-				if audioFrame == nil {
-					continue
-				}
+		for frame := range pipeline.Frames(audioStream) {
+			audioFrame := frame.(*reisen.AudioFrame)
 
-				// Turn the raw byte data into
-				// audio samples of type [2]float64.
-				reader := bytes.NewReader(audioFrame.Data())
-
-				// See the README.md file for
-				// detailed scheme of the sample structure.
-				for reader.Len() > 0 {
-					sample := [2]float64{0, 0}
-					var result float64
-					err = binary.Read(reader, binary.LittleEndian, &result)
-
-					if err != nil {
-						go func(err error) {
-							fmt.Printf("StreamAudio.2: Error to the chan: %v\n", err)
-							errs <- err
-						}(err)
-					}
-
-					sample[0] = result
-
-					err = binary.Read(reader, binary.LittleEndian, &result)
-
-					if err != nil {
-						go func(err error) {
-							fmt.Printf("StreamAudio.3: Error to the chan: %v\n", err)
-							errs <- err
-						}(err)
-					}
-
-					sample[1] = result
-					sampleBuffer <- sample
-				}
-			case reisen.StreamData:
-				s := media.Streams()[packet.StreamIndex()].(*reisen.DataStream)
-				gotDataFrame, gotFrame, err := s.ReadFrame()
-
-				if err != nil {
-					go func(err error) {
-						fmt.Printf("StreamData: Error to the chan: %v\n", err)
-						errs <- err
-					}(err)
-				}
+			for _, sample := range audioFrame.Samples() {
+				sampleBuffer <- sample
+			}
+		}
+	}()
 
-				if !gotFrame {
-					break
-				}
+	go func() {
+		defer wg.Done()
+		defer close(dataFrame)
 
-				if gotDataFrame == nil {
-					continue
-				}
-				if df, ok := gotDataFrame.(*reisen.DataFrame); !ok {
-					fmt.Println("cannot assign data frame")
-				} else {
-					dataFrame <- df
-				}
+		for frame := range pipeline.Frames(gmpdDataStream) {
+			if df, ok := frame.(*reisen.DataFrame); !ok {
+				fmt.Println("cannot assign data frame")
+			} else {
+				dataFrame <- df
 			}
 		}
+	}()
+
+	go func() {
+		wg.Wait()
 		fmt.Println("=========== FINISH DECODING DATA ===================")
 		stopStat = true
+
+		// The demuxer can still be reading
+		// the media if a decoder has failed.
+		pipeline.Stop()
 		videoStream.Close()
 		audioStream.Close()
+		gmpdDataStream.Close()
 		media.CloseDecode()
-		close(frameBuffer)
-		close(sampleBuffer)
-		close(dataFrame)
-		close(errs)
 	}()
-	return frameBuffer, sampleBuffer, dataFrame, errs, nil
+
+	return frameBuffer, sampleBuffer, dataFrame, pipeline.Errors(), nil
 }
 
 // streamSamples creates a new custom streamer for
@@ -0,0 +1,239 @@
+package reisen
+
+// #cgo pkg-config: libavutil
+// #include <libavutil/pixdesc.h>
+// #include <libavutil/pixfmt.h>
+import "C"
+
+// ColorTransfer is a transfer characteristic
+// of the video (e.g. BT.709, PQ or HLG).
+type ColorTransfer int
+
+const (
+	// ColorTransferUnspecified means the transfer is unknown.
+	ColorTransferUnspecified ColorTransfer = C.AVCOL_TRC_UNSPECIFIED
+	// ColorTransferBT709 is the transfer of HD video.
+	ColorTransferBT709 ColorTransfer = C.AVCOL_TRC_BT709
+	// ColorTransferSMPTE170M is the transfer of SD video.
+	ColorTransferSMPTE170M ColorTransfer = C.AVCOL_TRC_SMPTE170M
+	// ColorTransferLinear is the linear light transfer.
+	ColorTransferLinear ColorTransfer = C.AVCOL_TRC_LINEAR
+	// ColorTransferSRGB is the sRGB transfer.
+	ColorTransferSRGB ColorTransfer = C.AVCOL_TRC_IEC61966_2_1
+	// ColorTransferBT2020_10 is the BT.2020 10-bit transfer.
+	ColorTransferBT2020_10 ColorTransfer = C.AVCOL_TRC_BT2020_10
+	// ColorTransferBT2020_12 is the BT.2020 12-bit transfer.
+	ColorTransferBT2020_12 ColorTransfer = C.AVCOL_TRC_BT2020_12
+	// ColorTransferPQ is the perceptual quantizer HDR transfer.
+	ColorTransferPQ ColorTransfer = C.AVCOL_TRC_SMPTE2084
+	// ColorTransferHLG is the hybrid log-gamma HDR transfer.
+	ColorTransferHLG ColorTransfer = C.AVCOL_TRC_ARIB_STD_B67
+)
+
+// String returns the libAV name
+// of the transfer characteristic.
+func (transfer ColorTransfer) String() string {
+	name := C.av_color_transfer_name(
+		C.enum_AVColorTransferCharacteristic(transfer))
+
+	if name == nil {
+		return ""
+	}
+
+	return C.GoString(name)
+}
+
+// HDR returns 'true' if the transfer characteristic
+// is meant for high dynamic range video.
+func (transfer ColorTransfer) HDR() bool {
+	return transfer == ColorTransferPQ ||
+		transfer == ColorTransferHLG
+}
+
+// ColorPrimaries are the chromaticity coordinates
+// of the source primaries of the video.
+type ColorPrimaries int
+
+const (
+	// ColorPrimariesUnspecified means the primaries are unknown.
+	ColorPrimariesUnspecified ColorPrimaries = C.AVCOL_PRI_UNSPECIFIED
+	// ColorPrimariesBT709 are the primaries of HD video.
+	ColorPrimariesBT709 ColorPrimaries = C.AVCOL_PRI_BT709
+	// ColorPrimariesBT470BG are the primaries of PAL video.
+	ColorPrimariesBT470BG ColorPrimaries = C.AVCOL_PRI_BT470BG
+	// ColorPrimariesSMPTE170M are the primaries of NTSC video.
+	ColorPrimariesSMPTE170M ColorPrimaries = C.AVCOL_PRI_SMPTE170M
+	// ColorPrimariesBT2020 are the wide gamut primaries of UHD video.
+	ColorPrimariesBT2020 ColorPrimaries = C.AVCOL_PRI_BT2020
+	// ColorPrimariesDCIP3 are the Display P3 primaries.
+	ColorPrimariesDCIP3 ColorPrimaries = C.AVCOL_PRI_SMPTE432
+)
+
+// String returns the libAV name
+// of the color primaries.
+func (primaries ColorPrimaries) String() string {
+	name := C.av_color_primaries_name(
+		C.enum_AVColorPrimaries(primaries))
+
+	if name == nil {
+		return ""
+	}
+
+	return C.GoString(name)
+}
+
+// ColorTransfer returns the transfer
+// characteristic of the video stream.
+func (video *VideoStream) ColorTransfer() ColorTransfer {
+	return ColorTransfer(video.codecParams.color_trc)
+}
+
+// ColorPrimaries returns the color
+// primaries of the video stream.
+func (video *VideoStream) ColorPrimaries() ColorPrimaries {
+	return ColorPrimaries(video.codecParams.color_primaries)
+}
+
+// BitDepth returns the number of bits per
+// color component of the video stream or
+// 0 if it's unknown.
+func (video *VideoStream) BitDepth() int {
+	if video.codecParams.bits_per_raw_sample > 0 {
+		return int(video.codecParams.bits_per_raw_sample)
+	}
+
+	desc := C.av_pix_fmt_desc_get(
+		C.enum_AVPixelFormat(video.codecParams.format))
+
+	if desc == nil {
+		return 0
+	}
+
+	return int(desc.comp[0].depth)
+}
+
+// ColorSpace is a YUV color space (matrix
+// coefficients) of the video.
+type ColorSpace int
+
+const (
+	// ColorSpaceRGB means the components are RGB, not YUV.
+	ColorSpaceRGB ColorSpace = C.AVCOL_SPC_RGB
+	// ColorSpaceBT709 is the color space of HD video.
+	ColorSpaceBT709 ColorSpace = C.AVCOL_SPC_BT709
+	// ColorSpaceUnspecified means the color space is unknown.
+	ColorSpaceUnspecified ColorSpace = C.AVCOL_SPC_UNSPECIFIED
+	// ColorSpaceFCC is the FCC color space.
+	ColorSpaceFCC ColorSpace = C.AVCOL_SPC_FCC
+	// ColorSpaceBT470BG is the color space of PAL video.
+	ColorSpaceBT470BG ColorSpace = C.AVCOL_SPC_BT470BG
+	// ColorSpaceSMPTE170M is the color space of NTSC video.
+	ColorSpaceSMPTE170M ColorSpace = C.AVCOL_SPC_SMPTE170M
+	// ColorSpaceSMPTE240M is the SMPTE 240M color space.
+	ColorSpaceSMPTE240M ColorSpace = C.AVCOL_SPC_SMPTE240M
+	// ColorSpaceBT2020NCL is the BT.2020 non-constant luminance color space.
+	ColorSpaceBT2020NCL ColorSpace = C.AVCOL_SPC_BT2020_NCL
+	// ColorSpaceBT2020CL is the BT.2020 constant luminance color space.
+	ColorSpaceBT2020CL ColorSpace = C.AVCOL_SPC_BT2020_CL
+)
+
+// String returns the libAV name
+// of the color space.
+func (space ColorSpace) String() string {
+	name := C.av_color_space_name(
+		C.enum_AVColorSpace(space))
+
+	if name == nil {
+		return ""
+	}
+
+	return C.GoString(name)
+}
+
+// ColorRange is a range of the
+// color values of the video.
+type ColorRange int
+
+const (
+	// ColorRangeUnspecified means the range is unknown.
+	ColorRangeUnspecified ColorRange = C.AVCOL_RANGE_UNSPECIFIED
+	// ColorRangeLimited is the limited
+	// (MPEG, TV) range, e.g. 16-235
+	// for the 8-bit luma.
+	ColorRangeLimited ColorRange = C.AVCOL_RANGE_MPEG
+	// ColorRangeFull is the full
+	// (JPEG, PC) range, e.g. 0-255
+	// for the 8-bit luma.
+	ColorRangeFull ColorRange = C.AVCOL_RANGE_JPEG
+)
+
+// String returns the libAV name
+// of the color range.
+func (colorRange ColorRange) String() string {
+	name := C.av_color_range_name(
+		C.enum_AVColorRange(colorRange))
+
+	if name == nil {
+		return ""
+	}
+
+	return C.GoString(name)
+}
+
+// ColorSpace returns the color space the
+// frames are converted from: either the one
+// set with SetColorSpace or the one the
+// stream is tagged with.
+func (video *VideoStream) ColorSpace() ColorSpace {
+	if video.colorSpaceSet {
+		return video.colorSpace
+	}
+
+	if video.codecCtx != nil {
+		return ColorSpace(video.codecCtx.colorspace)
+	}
+
+	return ColorSpace(video.codecParams.color_space)
+}
+
+// ColorRange returns the color range the
+// frames are converted from: either the one
+// set with SetColorRange or the one the
+// stream is tagged with.
+func (video *VideoStream) ColorRange() ColorRange {
+	if video.colorRangeSet {
+		return video.colorRange
+	}
+
+	if video.codecCtx != nil {
+		return ColorRange(video.codecCtx.color_range)
+	}
+
+	return ColorRange(video.codecParams.color_range)
+}
+
+// SetColorSpace overrides the color space of
+// the mis-tagged stream. ColorSpaceUnspecified
+// restores the one the stream is tagged with.
+//
+// It can be called before or after
+// the stream is opened.
+func (video *VideoStream) SetColorSpace(space ColorSpace) error {
+	video.colorSpace = space
+	video.colorSpaceSet = space != ColorSpaceUnspecified
+
+	return video.applyColorDetails()
+}
+
+// SetColorRange overrides the color range of
+// the mis-tagged stream. ColorRangeUnspecified
+// restores the one the stream is tagged with.
+//
+// It can be called before or after
+// the stream is opened.
+func (video *VideoStream) SetColorRange(colorRange ColorRange) error {
+	video.colorRange = colorRange
+	video.colorRangeSet = colorRange != ColorRangeUnspecified
+
+	return video.applyColorDetails()
+}
@@ -5,7 +5,6 @@ package reisen
 import "C"
 import (
 	"bytes"
-	"fmt"
 	"io"
 
 	"github.com/kibab/gopro-utils/telemetry"
@@ -60,11 +59,12 @@ func (frame *DataFrame) Telemetry() TelemetryData {
 }
 
 // newDataFrame returns a newly created data frame.
-func newDataFrame(stream Stream, pts int64, data []byte, telemetryData TelemetryData) *DataFrame {
+func newDataFrame(stream Stream, pts, duration int64, data []byte, telemetryData TelemetryData) *DataFrame {
 	frame := new(DataFrame)
 
 	frame.stream = stream
 	frame.pts = pts
+	frame.duration = duration
 	frame.data = data
 	frame.tData = telemetryData
 	return frame
@@ -126,34 +126,83 @@ func (gs *DataStream) ReadFrame() (Frame, bool, error) {
 	if !gs.isOpened {
 		return nil, false, nil
 	}
-	pkt := newPacket(gs.media, gs.media.packet)
+
+	err := gs.parkPending()
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	packet, ok, err := gs.nextPacket()
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The packet has already been consumed
+	// or the end of the media is reached.
+	if !ok || packet == nil {
+		return nil, false, nil
+	}
+
+	pkt := newPacket(gs.media, packet)
+	C.av_packet_free(&packet)
 	gs.contents.Write(pkt.Data())
 	frame, handled := gs.nativeCodec.handler(gs, pkt)
+
+	// The packet doesn't complete a frame,
+	// so the frame is skipped.
 	if !handled {
-		return nil, false, nil
+		return nil, true, nil
 	}
+
+	gs.timestamps.track(pkt.pts, pkt.duration, false)
+
 	return frame, true, nil
 }
 
+// Flush returns the frames left in the data
+// stream after the end of the media has been
+// reached. The data streams are not decoded by
+// libAV, so nothing is buffered inside a codec.
+func (gs *DataStream) Flush() ([]Frame, error) {
+	return []Frame{}, nil
+}
+
+// Opened returns 'true' if the stream
+// is opened for decoding.
+func (gs *DataStream) Opened() bool {
+	return gs.isOpened
+}
+
+// reset drops the data buffered
+// for decoding after seeking.
+func (gs *DataStream) reset() {
+	gs.baseStream.reset()
+	gs.contents.Reset()
+}
+
 func gmpdFrameHandler(gs *DataStream, pkt *Packet) (Frame, bool) {
 	for {
 		telem := &telemetry.TELEM{}
 		telem, err := telemetry.Read(telem, &gs.contents)
 
 		if telem != nil && telem.Gps != nil {
-			fmt.Printf("Number of GPS samples: %d\n", len(telem.Gps))
+			logger().Debug("GPS samples read",
+				"stream", gs.Index(), "count", len(telem.Gps))
 			tdata := TelemetryData{
 				Lat:      telem.Gps[0].Latitude,
 				Long:     telem.Gps[0].Longitude,
 				Accuracy: telem.GpsAccuracy.Accuracy,
 			}
-			return newDataFrame(gs, pkt.pts, pkt.Data(), tdata), true
+			return newDataFrame(gs, pkt.pts, pkt.duration, pkt.Data(), tdata), true
 		}
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			fmt.Printf("Telemetry read err: %v", err)
+			logger().Warn("couldn't read the telemetry",
+				"stream", gs.Index(), "error", err)
 			return nil, false
 		}
 	}
@@ -169,5 +218,6 @@ func genericFrameHandler(gs *DataStream, pkt *Packet) (Frame, bool) {
 // stops decoding frames.
 func (gs *DataStream) Close() error {
 	gs.contents.Truncate(0)
-	return nil
+	gs.isOpened = false
+	return gs.close()
 }
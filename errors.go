@@ -1,17 +1,104 @@
 package reisen
 
+// #cgo pkg-config: libavutil
+// #include <errno.h>
+// #include <libavutil/error.h>
+//
+// // The POSIX error codes differ between
+// // the platforms, so the libAV status
+// // codes are taken from the C headers.
+// enum {
+//     errorAgain           = AVERROR(EAGAIN),
+//     errorNoMemory        = AVERROR(ENOMEM),
+//     errorInvalidValue    = AVERROR(EINVAL),
+//     errorInvalidData     = AVERROR_INVALIDDATA,
+//     errorEndOfFile       = AVERROR_EOF,
+//     errorOptionNotFound  = AVERROR_OPTION_NOT_FOUND,
+//     errorDemuxerNotFound = AVERROR_DEMUXER_NOT_FOUND,
+// };
+import "C"
+import "fmt"
+
+// ErrorType is a status code
+// returned by libAV functions.
+//
+// It can be compared with the errors
+// returned by the library using errors.Is.
 type ErrorType int
 
 const (
 	// ErrorAgain is returned when
 	// the decoder needs more data
 	// to serve the frame.
-	ErrorAgain ErrorType = -11
+	ErrorAgain ErrorType = C.errorAgain
+	// ErrorNoMemory is returned
+	// when memory couldn't be
+	// allocated.
+	ErrorNoMemory ErrorType = C.errorNoMemory
 	// ErrorInvalidValue is returned
 	// when the function call argument
 	// is invalid.
-	ErrorInvalidValue ErrorType = -22
+	ErrorInvalidValue ErrorType = C.errorInvalidValue
+	// ErrorInvalidData is returned
+	// when the media data is corrupt.
+	ErrorInvalidData ErrorType = C.errorInvalidData
 	// ErrorEndOfFile is returned upon
 	// reaching the end of the media file.
-	ErrorEndOfFile ErrorType = -541478725
+	ErrorEndOfFile ErrorType = C.errorEndOfFile
+	// ErrorOptionNotFound is returned
+	// when the options are not
+	// recognized.
+	ErrorOptionNotFound ErrorType = C.errorOptionNotFound
+	// ErrorDemuxerNotFound is returned
+	// when the media format is unknown.
+	ErrorDemuxerNotFound ErrorType = C.errorDemuxerNotFound
 )
+
+// Error returns the libAV
+// description of the status code.
+func (errorType ErrorType) Error() string {
+	buf := make([]C.char, C.AV_ERROR_MAX_STRING_SIZE)
+	C.av_strerror(C.int(errorType), &buf[0], C.size_t(len(buf)))
+
+	return C.GoString(&buf[0])
+}
+
+// wrap returns a new error of the operation
+// failed with the status code.
+func (errorType ErrorType) wrap(op string) error {
+	return &AVError{
+		Code:    errorType,
+		Op:      op,
+		Message: errorType.Error(),
+	}
+}
+
+// AVError is an error of an operation
+// failed with a libAV status code.
+type AVError struct {
+	// Code is the libAV status code.
+	Code ErrorType
+	// Op is the description of
+	// the failed operation.
+	Op string
+	// Message is the libAV
+	// description of the code.
+	Message string
+}
+
+// Error returns the text of the error.
+func (err *AVError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Op, err.Message)
+}
+
+// Unwrap returns the status code
+// the operation failed with.
+func (err *AVError) Unwrap() error {
+	return err.Code
+}
+
+// newAVError returns a new error of the
+// operation failed with the libAV status.
+func newAVError(status C.int, op string) error {
+	return ErrorType(status).wrap(op)
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 
 	"github.com/zergon321/reisen"
 )
@@ -20,13 +23,19 @@ func main() {
 	fmt.Println("Format long name:", media.FormatLongName())
 	fmt.Println("MIME type:", media.FormatMIMEType())
 	fmt.Println("Number of streams:", media.StreamCount())
+	fmt.Println("Metadata:", media.Metadata())
 	fmt.Println()
 
 	// Enumerate the media file streams.
 	for _, stream := range media.Streams() {
 		dur, err := stream.Duration()
-		handleError(err)
-		tbNum, tbDen := stream.TimeBase()
+
+		// Some containers don't store
+		// the durations of the streams.
+		if !errors.Is(err, reisen.ErrNoTimestamp) {
+			handleError(err)
+		}
+
 		fpsNum, fpsDen := stream.FrameRate()
 
 		// Print the properties common
@@ -37,95 +46,64 @@ func main() {
 		fmt.Println("Codec long name:", stream.CodecLongName())
 		fmt.Println("Stream duration:", dur)
 		fmt.Println("Stream bit rate:", stream.BitRate())
-		fmt.Printf("Time base: %d/%d\n", tbNum, tbDen)
+		fmt.Println("Time base:", stream.TimeBaseRational())
 		fmt.Printf("Frame rate: %d/%d\n", fpsNum, fpsDen)
 		fmt.Println("Frame count:", stream.FrameCount())
+		fmt.Println("Metadata:", stream.Metadata())
 		fmt.Println()
 	}
 
 	// Do decoding.
 	err = media.OpenDecode()
 	handleError(err)
-	gotPacket := true
-
-	for i := 0; i < 9 && gotPacket; i++ {
-		// Read packets one by one. A packet
-		// can contain either a video frame
-		// or an audio frame.
-		var pkt *reisen.Packet
-		pkt, gotPacket, err = media.ReadPacket()
+
+	for _, stream := range media.VideoStreams() {
+		err = stream.Open()
+		handleError(err)
+	}
+
+	for _, stream := range media.AudioStreams() {
+		err = stream.Open()
 		handleError(err)
+	}
+
+	// Read the frames of all the
+	// opened streams one by one.
+	frames := media.Frames(context.Background())
+
+	for i := 0; i < 9; i++ {
+		frame, err := frames.Next()
 
 		// Check if the media file
 		// is depleted.
-		if !gotPacket {
+		if err == io.EOF {
 			break
 		}
 
-		// Determine what stream
-		// the packet belongs to.
-		switch pkt.Type() {
-		case reisen.StreamVideo:
-			s := media.Streams()[pkt.StreamIndex()].(*reisen.VideoStream)
-
-			if !s.Opened() {
-				err = s.Open()
-				handleError(err)
-			}
-
-			videoFrame, gotFrame, err := s.ReadVideoFrame()
-			handleError(err)
-
-			// If the media file is
-			// depleted.
-			if !gotFrame {
-				break
-			}
-
-			// If the packet doesn't
-			// contain a whole frame,
-			// just skip it.
-			if videoFrame == nil {
-				continue
-			}
-
-			pts, err := videoFrame.PresentationOffset()
-			handleError(err)
-
-			fmt.Println("Presentation duration offset:", pts)
-			fmt.Println("Number of pixels:", len(videoFrame.Image().Pix))
-			fmt.Println("Coded picture number:", videoFrame.IndexCoded())
-			fmt.Println("Display picture number:", videoFrame.IndexDisplay())
-			fmt.Println()
-
-		case reisen.StreamAudio:
-			s := media.Streams()[pkt.StreamIndex()].(*reisen.AudioStream)
-
-			if !s.Opened() {
-				err = s.Open()
-				handleError(err)
-			}
-
-			audioFrame, gotFrame, err := s.ReadAudioFrame()
-			handleError(err)
-
-			if !gotFrame {
-				break
-			}
+		handleError(err)
 
-			if audioFrame == nil {
-				continue
-			}
+		pts, err := frame.PresentationOffset()
+		handleError(err)
 
-			pts, err := audioFrame.PresentationOffset()
-			handleError(err)
+		fmt.Println("Stream index:", frame.Stream().Index())
+		fmt.Println("Presentation timestamp:", frame.PTS())
+		fmt.Println("Presentation duration offset:", pts)
 
-			fmt.Println("Presentation duration offset:", pts)
-			fmt.Println("Data length:", len(audioFrame.Data()))
-			fmt.Println("Coded picture number:", audioFrame.IndexCoded())
-			fmt.Println("Display picture number:", audioFrame.IndexDisplay())
-			fmt.Println()
+		// Determine what stream
+		// the frame belongs to.
+		switch f := frame.(type) {
+		case *reisen.VideoFrame:
+			fmt.Println("Number of pixels:", len(f.Data()))
+			fmt.Println("Coded picture number:", f.IndexCoded())
+			fmt.Println("Display picture number:", f.IndexDisplay())
+
+		case *reisen.AudioFrame:
+			fmt.Println("Data length:", len(f.Data()))
+			fmt.Println("Coded picture number:", f.IndexCoded())
+			fmt.Println("Display picture number:", f.IndexDisplay())
 		}
+
+		fmt.Println()
 	}
 
 	for _, stream := range media.Streams() {
@@ -1,8 +1,6 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
 	"image"
 	"time"
@@ -20,7 +18,7 @@ const (
 	channelCount                      = 2
 	bitDepth                          = 8
 	sampleBufferSize                  = 32 * channelCount * bitDepth * 1024
-	SpeakerSampleRate beep.SampleRate = 44100
+	SpeakerSampleRate beep.SampleRate = sampleRate
 )
 
 // readVideoAndAudio reads video and audio frames
@@ -45,8 +43,12 @@ func readVideoAndAudio(media *reisen.Media) (<-chan *image.RGBA, <-chan [2]float
 		return nil, nil, nil, err
 	}
 
+	// Resample the audio to
+	// the rate of the speaker.
 	audioStream := media.AudioStreams()[0]
-	err = audioStream.Open()
+	err = audioStream.OpenDecode(reisen.AudioFormat{
+		SampleRate: sampleRate,
+	})
 
 	if err != nil {
 		return nil, nil, nil, err
@@ -105,7 +107,7 @@ func readVideoAndAudio(media *reisen.Media) (<-chan *image.RGBA, <-chan [2]float
 					fmt.Printf("Error while obtining presentation offset: %v\n", err)
 				}
 				fmt.Printf("VideoFrame TS = %d\n", off)
-				frameBuffer <- videoFrame.Image()
+				frameBuffer <- videoFrame.Image().(*image.RGBA)
 
 			case reisen.StreamAudio:
 				s := media.Streams()[packet.StreamIndex()].(*reisen.AudioStream)
@@ -125,34 +127,7 @@ func readVideoAndAudio(media *reisen.Media) (<-chan *image.RGBA, <-chan [2]float
 					continue
 				}
 
-				// Turn the raw byte data into
-				// audio samples of type [2]float64.
-				reader := bytes.NewReader(audioFrame.Data())
-
-				// See the README.md file for
-				// detailed scheme of the sample structure.
-				for reader.Len() > 0 {
-					sample := [2]float64{0, 0}
-					var result float64
-					err = binary.Read(reader, binary.LittleEndian, &result)
-
-					if err != nil {
-						go func(err error) {
-							errs <- err
-						}(err)
-					}
-
-					sample[0] = result
-
-					err = binary.Read(reader, binary.LittleEndian, &result)
-
-					if err != nil {
-						go func(err error) {
-							errs <- err
-						}(err)
-					}
-
-					sample[1] = result
+				for _, sample := range audioFrame.Samples() {
 					sampleBuffer <- sample
 				}
 			case reisen.StreamData:
@@ -0,0 +1,416 @@
+package reisen
+
+// #cgo pkg-config: libavfilter libavutil
+// #include <stdlib.h>
+// #include <libavfilter/avfilter.h>
+// #include <libavfilter/buffersink.h>
+// #include <libavfilter/buffersrc.h>
+// #include <libavutil/channel_layout.h>
+// #include <libavutil/samplefmt.h>
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// filterGraph is a libavfilter graph the
+// decoded frames of the stream go through
+// before they are converted to the output
+// format.
+//
+// The graph is configured for the parameters
+// of the first frame it receives, and built
+// anew when they change.
+type filterGraph struct {
+	description string
+	graph       *C.AVFilterGraph
+	source      *C.AVFilterContext
+	sink        *C.AVFilterContext
+	width       C.int
+	height      C.int
+	format      C.int
+	sar         C.AVRational
+	sampleRate  C.int
+	layout      C.AVChannelLayout
+}
+
+// setFilterGraph replaces the filter graph of
+// the stream with the one parsed from the
+// description. The empty description removes
+// the filter graph. The frames left in the old
+// graph are still returned by the stream.
+func (stream *baseStream) setFilterGraph(description string) error {
+	if description != "" {
+		err := checkFilterGraph(description)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// The frames buffered inside the old
+	// graph are queued before it's freed.
+	err := stream.flushFilterGraph()
+
+	if err != nil {
+		return err
+	}
+
+	stream.freeFilterGraph()
+
+	if description != "" {
+		stream.graph = &filterGraph{
+			description: description,
+		}
+	}
+
+	return nil
+}
+
+// filterGraphDescription returns the description
+// of the filter graph of the stream or "" if
+// there's no filter graph.
+func (stream *baseStream) filterGraphDescription() string {
+	if stream.graph == nil {
+		return ""
+	}
+
+	return stream.graph.description
+}
+
+// freeFilterGraph removes the
+// filter graph of the stream.
+func (stream *baseStream) freeFilterGraph() {
+	if stream.graph == nil {
+		return
+	}
+
+	stream.graph.free()
+	stream.graph = nil
+}
+
+// checkFilterGraph parses the filter graph
+// description to report syntax errors and
+// unknown filters before any frame is decoded.
+func checkFilterGraph(description string) error {
+	graph := C.avfilter_graph_alloc()
+
+	if graph == nil {
+		return ErrorNoMemory.wrap(
+			"couldn't allocate a filter graph")
+	}
+
+	defer C.avfilter_graph_free(&graph)
+
+	var inputs, outputs *C.AVFilterInOut
+
+	cDescription := C.CString(description)
+	status := C.avfilter_graph_parse2(graph,
+		cDescription, &inputs, &outputs)
+	C.free(unsafe.Pointer(cDescription))
+	C.avfilter_inout_free(&inputs)
+	C.avfilter_inout_free(&outputs)
+
+	if status < 0 {
+		return newAVError(status,
+			"couldn't parse the filter graph")
+	}
+
+	return nil
+}
+
+// filterFrame sends the decoded frame through
+// the filter graph of the stream and puts all
+// the frames it produces to the queue of the
+// stream. The frame is consumed.
+func (stream *baseStream) filterFrame(frame *C.AVFrame) error {
+	if stream.graph == nil {
+		stream.frames = append(stream.frames, frame)
+		return nil
+	}
+
+	defer C.av_frame_free(&frame)
+
+	if stream.graph.graph != nil && !stream.graph.accepts(frame) {
+		// Obtain the frames left in the
+		// old graph before replacing it.
+		err := stream.flushFilterGraph()
+
+		if err != nil {
+			return err
+		}
+
+		stream.graph.free()
+	}
+
+	if stream.graph.graph == nil {
+		err := stream.graph.build(stream, frame)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	status := C.av_buffersrc_add_frame(
+		stream.graph.source, frame)
+
+	if status < 0 {
+		return newAVError(status,
+			"couldn't send the frame to the filter graph")
+	}
+
+	return stream.receiveFiltered()
+}
+
+// flushFilterGraph signals the end of the
+// stream to the filter graph and puts the
+// frames left in it to the queue of the
+// stream.
+func (stream *baseStream) flushFilterGraph() error {
+	if stream.graph == nil || stream.graph.graph == nil {
+		return nil
+	}
+
+	status := C.av_buffersrc_add_frame(
+		stream.graph.source, nil)
+
+	if status < 0 && status != C.int(ErrorEndOfFile) {
+		return newAVError(status,
+			"couldn't flush the filter graph")
+	}
+
+	return stream.receiveFiltered()
+}
+
+// receiveFiltered moves all the frames available
+// at the output of the filter graph to the queue
+// of the stream. The timestamps of the frames are
+// converted back to the time base of the stream.
+func (stream *baseStream) receiveFiltered() error {
+	timeBase := C.av_buffersink_get_time_base(
+		stream.graph.sink)
+
+	for {
+		frame := C.av_frame_alloc()
+
+		if frame == nil {
+			return ErrorNoMemory.wrap(
+				"couldn't allocate a new frame")
+		}
+
+		status := C.av_buffersink_get_frame(
+			stream.graph.sink, frame)
+
+		if status < 0 {
+			C.av_frame_free(&frame)
+
+			// All the frames produced
+			// by the graph are received.
+			if status == C.int(ErrorAgain) ||
+				status == C.int(ErrorEndOfFile) {
+				return nil
+			}
+
+			return newAVError(status,
+				"couldn't receive the frame from the filter graph")
+		}
+
+		if C.av_cmp_q(timeBase, stream.inner.time_base) != 0 {
+			rescaleFrame(frame, timeBase, stream.inner.time_base)
+		}
+
+		stream.frames = append(stream.frames, frame)
+	}
+}
+
+// rescaleFrame converts the timestamps
+// of the frame to another time base.
+func rescaleFrame(frame *C.AVFrame, from, to C.AVRational) {
+	if frame.pts != noTimestamp {
+		frame.pts = C.av_rescale_q(frame.pts, from, to)
+	}
+
+	if frame.best_effort_timestamp != noTimestamp {
+		frame.best_effort_timestamp = C.av_rescale_q(
+			frame.best_effort_timestamp, from, to)
+	}
+
+	if frame.duration > 0 {
+		frame.duration = C.av_rescale_q(
+			frame.duration, from, to)
+	}
+}
+
+// accepts returns 'true' if the filter
+// graph is configured for the parameters
+// of the frame.
+func (graph *filterGraph) accepts(frame *C.AVFrame) bool {
+	if frame.format != graph.format {
+		return false
+	}
+
+	if frame.nb_samples > 0 {
+		return frame.sample_rate == graph.sampleRate &&
+			C.av_channel_layout_compare(
+				&frame.ch_layout, &graph.layout) == 0
+	}
+
+	return frame.width == graph.width &&
+		frame.height == graph.height &&
+		C.av_cmp_q(frame.sample_aspect_ratio, graph.sar) == 0
+}
+
+// build creates the filter graph between a buffer
+// source configured for the parameters of the frame
+// and a buffer sink.
+func (graph *filterGraph) build(stream *baseStream, frame *C.AVFrame) error {
+	sourceName, sinkName := "buffer", "buffersink"
+	timeBase := stream.inner.time_base
+	args := ""
+
+	if stream.Type() == StreamAudio {
+		sourceName, sinkName = "abuffer", "abuffersink"
+		layout := make([]C.char, 64)
+		status := C.av_channel_layout_describe(&frame.ch_layout,
+			&layout[0], C.size_t(len(layout)))
+
+		if status < 0 {
+			return newAVError(status,
+				"couldn't describe the channel layout")
+		}
+
+		args = fmt.Sprintf(
+			"time_base=%d/%d:sample_rate=%d:sample_fmt=%s:channel_layout=%s",
+			timeBase.num, timeBase.den, frame.sample_rate,
+			C.GoString(C.av_get_sample_fmt_name(
+				C.enum_AVSampleFormat(frame.format))),
+			C.GoString(&layout[0]))
+	} else {
+		sar := frame.sample_aspect_ratio
+
+		if sar.num <= 0 || sar.den <= 0 {
+			sar = C.AVRational{num: 0, den: 1}
+		}
+
+		args = fmt.Sprintf(
+			"video_size=%dx%d:pix_fmt=%d:time_base=%d/%d:pixel_aspect=%d/%d",
+			frame.width, frame.height, frame.format,
+			timeBase.num, timeBase.den, sar.num, sar.den)
+	}
+
+	graph.graph = C.avfilter_graph_alloc()
+
+	if graph.graph == nil {
+		return ErrorNoMemory.wrap(
+			"couldn't allocate a filter graph")
+	}
+
+	err := graph.configure(sourceName, sinkName, args)
+
+	if err != nil {
+		graph.free()
+		return err
+	}
+
+	graph.format = frame.format
+	graph.width = frame.width
+	graph.height = frame.height
+	graph.sar = frame.sample_aspect_ratio
+	graph.sampleRate = frame.sample_rate
+	status := C.av_channel_layout_copy(
+		&graph.layout, &frame.ch_layout)
+
+	if status < 0 {
+		graph.free()
+
+		return newAVError(status,
+			"couldn't copy the channel layout")
+	}
+
+	return nil
+}
+
+// configure creates the buffer source and the
+// buffer sink, links them with the filters of
+// the description and configures the graph.
+func (graph *filterGraph) configure(sourceName, sinkName, args string) error {
+	cSourceName := C.CString(sourceName)
+	cSinkName := C.CString(sinkName)
+	cIn := C.CString("in")
+	cOut := C.CString("out")
+	cArgs := C.CString(args)
+	defer C.free(unsafe.Pointer(cSourceName))
+	defer C.free(unsafe.Pointer(cSinkName))
+	defer C.free(unsafe.Pointer(cIn))
+	defer C.free(unsafe.Pointer(cOut))
+	defer C.free(unsafe.Pointer(cArgs))
+
+	status := C.avfilter_graph_create_filter(&graph.source,
+		C.avfilter_get_by_name(cSourceName), cIn,
+		cArgs, nil, graph.graph)
+
+	if status < 0 {
+		return newAVError(status,
+			"couldn't create the buffer source")
+	}
+
+	status = C.avfilter_graph_create_filter(&graph.sink,
+		C.avfilter_get_by_name(cSinkName), cOut,
+		nil, nil, graph.graph)
+
+	if status < 0 {
+		return newAVError(status,
+			"couldn't create the buffer sink")
+	}
+
+	// The output of the source is the
+	// input of the described filters,
+	// and vice versa for the sink.
+	outputs := C.avfilter_inout_alloc()
+	inputs := C.avfilter_inout_alloc()
+	defer C.avfilter_inout_free(&outputs)
+	defer C.avfilter_inout_free(&inputs)
+
+	if outputs == nil || inputs == nil {
+		return ErrorNoMemory.wrap(
+			"couldn't allocate the filter graph endpoints")
+	}
+
+	outputs.name = C.av_strdup(cIn)
+	outputs.filter_ctx = graph.source
+	outputs.pad_idx = 0
+	outputs.next = nil
+
+	inputs.name = C.av_strdup(cOut)
+	inputs.filter_ctx = graph.sink
+	inputs.pad_idx = 0
+	inputs.next = nil
+
+	cDescription := C.CString(graph.description)
+	status = C.avfilter_graph_parse_ptr(graph.graph,
+		cDescription, &inputs, &outputs, nil)
+	C.free(unsafe.Pointer(cDescription))
+
+	if status < 0 {
+		return newAVError(status,
+			"couldn't parse the filter graph")
+	}
+
+	status = C.avfilter_graph_config(graph.graph, nil)
+
+	if status < 0 {
+		return newAVError(status,
+			"couldn't configure the filter graph")
+	}
+
+	return nil
+}
+
+// free frees the filter graph keeping its
+// description, so it can be built again.
+func (graph *filterGraph) free() {
+	C.avfilter_graph_free(&graph.graph)
+	C.av_channel_layout_uninit(&graph.layout)
+	graph.source = nil
+	graph.sink = nil
+}
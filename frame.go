@@ -1,13 +1,14 @@
 package reisen
 
-import (
-	"fmt"
-	"time"
-)
+import "time"
 
 // Frame is an abstract data frame.
 type Frame interface {
+	Stream() Stream
 	Data() []byte
+	PTS() int64
+	Duration() int64
+	TimeBase() Rational
 	PresentationOffset() (time.Duration, error)
 	PresentationOffsetOrDie() time.Duration
 }
@@ -17,19 +18,45 @@ type Frame interface {
 type baseFrame struct {
 	stream       Stream
 	pts          int64
+	duration     int64
 	indexCoded   int
 	indexDisplay int
 }
 
+// Stream returns the stream
+// the frame was decoded from.
+func (frame *baseFrame) Stream() Stream {
+	return frame.stream
+}
+
+// PTS returns the presentation timestamp of
+// the frame in the time base units of its
+// stream or NoTimestamp if it's unknown.
+func (frame *baseFrame) PTS() int64 {
+	return frame.pts
+}
+
+// Duration returns the duration of the frame
+// in the time base units of its stream or 0
+// if it's unknown.
+func (frame *baseFrame) Duration() int64 {
+	return frame.duration
+}
+
+// TimeBase returns the time base
+// of the frame timestamps.
+func (frame *baseFrame) TimeBase() Rational {
+	return frame.stream.TimeBaseRational()
+}
+
 // PresentationOffset returns the duration offset
 // since the start of the media at which the frame
 // should be played.
+//
+// ErrNoTimestamp is returned if the
+// timestamp of the frame is unknown.
 func (frame *baseFrame) PresentationOffset() (time.Duration, error) {
-	tbNum, tbDen := frame.stream.TimeBase()
-	tb := float64(tbNum) / float64(tbDen)
-	tm := float64(frame.pts) * tb
-
-	return time.ParseDuration(fmt.Sprintf("%fs", tm))
+	return frame.TimeBase().Duration(frame.pts)
 }
 
 // PresentationOffsetOrDie is a more convenient function for
@@ -46,12 +73,20 @@ func (frame *baseFrame) PresentationOffsetOrDie() time.Duration {
 
 // IndexCoded returns the index of
 // the frame in the bitstream order.
+//
+// FFmpeg 7.0 and newer don't report it,
+// so there it's the index of the frame
+// among the ones read from the stream.
 func (frame *baseFrame) IndexCoded() int {
 	return frame.indexCoded
 }
 
 // IndexDisplay returns the index of
 // the frame in the display order.
+//
+// FFmpeg 7.0 and newer don't report it,
+// so there it's the index of the frame
+// among the ones read from the stream.
 func (frame *baseFrame) IndexDisplay() int {
 	return frame.indexDisplay
 }
@@ -0,0 +1,195 @@
+package reisen
+
+// #cgo pkg-config: libavutil
+// #include <libavutil/pixfmt.h>
+import "C"
+import (
+	"image"
+	"image/color"
+)
+
+// RGB is an in-memory image of
+// packed 24-bit RGB pixels.
+type RGB struct {
+	// Pix holds the pixels in the R, G, B
+	// order. The pixel at (x, y) starts
+	// at Pix[(y-Rect.Min.Y)*Stride+(x-Rect.Min.X)*3].
+	Pix []uint8
+	// Stride is the distance (in bytes)
+	// between vertically adjacent pixels.
+	Stride int
+	// Rect is the bounds of the image.
+	Rect image.Rectangle
+}
+
+// ColorModel returns the color
+// model of the image.
+func (img *RGB) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+// Bounds returns the
+// bounds of the image.
+func (img *RGB) Bounds() image.Rectangle {
+	return img.Rect
+}
+
+// At returns the color of
+// the pixel at (x, y).
+func (img *RGB) At(x, y int) color.Color {
+	return img.RGBAAt(x, y)
+}
+
+// RGBAAt returns the color of
+// the pixel at (x, y).
+func (img *RGB) RGBAAt(x, y int) color.RGBA {
+	if !(image.Point{x, y}.In(img.Rect)) {
+		return color.RGBA{}
+	}
+
+	i := img.PixOffset(x, y)
+
+	return color.RGBA{
+		R: img.Pix[i],
+		G: img.Pix[i+1],
+		B: img.Pix[i+2],
+		A: 0xff,
+	}
+}
+
+// PixOffset returns the index of the first
+// element of Pix for the pixel at (x, y).
+func (img *RGB) PixOffset(x, y int) int {
+	return (y-img.Rect.Min.Y)*img.Stride +
+		(x-img.Rect.Min.X)*3
+}
+
+// NV12 is an in-memory YUV 4:2:0 image
+// with a luma plane and an interleaved
+// chroma plane.
+type NV12 struct {
+	// Y is the luma plane.
+	Y []uint8
+	// CbCr is the chroma plane with
+	// the Cb and Cr samples interleaved.
+	CbCr []uint8
+	// YStride is the distance (in bytes)
+	// between vertically adjacent luma
+	// samples.
+	YStride int
+	// CStride is the distance (in bytes)
+	// between vertically adjacent chroma
+	// sample pairs.
+	CStride int
+	// Rect is the bounds of the image.
+	Rect image.Rectangle
+}
+
+// ColorModel returns the color
+// model of the image.
+func (img *NV12) ColorModel() color.Model {
+	return color.YCbCrModel
+}
+
+// Bounds returns the
+// bounds of the image.
+func (img *NV12) Bounds() image.Rectangle {
+	return img.Rect
+}
+
+// At returns the color of
+// the pixel at (x, y).
+func (img *NV12) At(x, y int) color.Color {
+	return img.YCbCrAt(x, y)
+}
+
+// YCbCrAt returns the color of
+// the pixel at (x, y).
+func (img *NV12) YCbCrAt(x, y int) color.YCbCr {
+	if !(image.Point{x, y}.In(img.Rect)) {
+		return color.YCbCr{}
+	}
+
+	yi := (y-img.Rect.Min.Y)*img.YStride + (x - img.Rect.Min.X)
+	ci := (y/2-img.Rect.Min.Y/2)*img.CStride +
+		(x/2-img.Rect.Min.X/2)*2
+
+	return color.YCbCr{
+		Y:  img.Y[yi],
+		Cb: img.CbCr[ci],
+		Cr: img.CbCr[ci+1],
+	}
+}
+
+// newImage wraps the contiguous buffer holding
+// the pixels of the libAV format into the
+// matching Go image. It returns nil if the
+// format has no matching image type.
+func newImage(format C.enum_AVPixelFormat, width, height int, data []byte) image.Image {
+	rect := image.Rect(0, 0, width, height)
+	chromaWidth := (width + 1) / 2
+	chromaHeight := (height + 1) / 2
+	lumaSize := width * height
+
+	switch format {
+	case C.AV_PIX_FMT_RGBA:
+		return &image.RGBA{
+			Pix:    data,
+			Stride: 4 * width,
+			Rect:   rect,
+		}
+
+	case C.AV_PIX_FMT_RGB24:
+		return &RGB{
+			Pix:    data,
+			Stride: 3 * width,
+			Rect:   rect,
+		}
+
+	case C.AV_PIX_FMT_RGBA64BE:
+		return &image.RGBA64{
+			Pix:    data,
+			Stride: 8 * width,
+			Rect:   rect,
+		}
+
+	case C.AV_PIX_FMT_GRAY16BE:
+		return &image.Gray16{
+			Pix:    data,
+			Stride: 2 * width,
+			Rect:   rect,
+		}
+
+	case C.AV_PIX_FMT_GRAY8:
+		return &image.Gray{
+			Pix:    data,
+			Stride: width,
+			Rect:   rect,
+		}
+
+	case C.AV_PIX_FMT_YUV420P, C.AV_PIX_FMT_YUVJ420P:
+		chromaSize := chromaWidth * chromaHeight
+
+		return &image.YCbCr{
+			Y:              data[:lumaSize],
+			Cb:             data[lumaSize : lumaSize+chromaSize],
+			Cr:             data[lumaSize+chromaSize : lumaSize+2*chromaSize],
+			YStride:        width,
+			CStride:        chromaWidth,
+			SubsampleRatio: image.YCbCrSubsampleRatio420,
+			Rect:           rect,
+		}
+
+	case C.AV_PIX_FMT_NV12:
+		return &NV12{
+			Y:       data[:lumaSize],
+			CbCr:    data[lumaSize:],
+			YStride: width,
+			CStride: 2 * chromaWidth,
+			Rect:    rect,
+		}
+
+	default:
+		return nil
+	}
+}
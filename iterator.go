@@ -0,0 +1,158 @@
+package reisen
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// FrameIterator reads the frames decoded
+// from the selected streams of the media
+// one by one.
+type FrameIterator struct {
+	ctx      context.Context
+	media    *Media
+	streams  map[int]Stream
+	order    []Stream
+	current  Stream
+	flushed  []Frame
+	depleted bool
+	err      error
+}
+
+// Frames returns an iterator over the frames
+// decoded from the specified streams of the media.
+// If no streams are specified, all the opened
+// streams are used.
+//
+// The media must be opened for decoding,
+// and the streams must be opened beforehand.
+func (media *Media) Frames(ctx context.Context, streams ...Stream) *FrameIterator {
+	iter := &FrameIterator{
+		ctx:     ctx,
+		media:   media,
+		streams: map[int]Stream{},
+	}
+
+	selected := len(streams) > 0
+
+	if !selected {
+		streams = media.streams
+	}
+
+	for _, stream := range streams {
+		if !stream.Opened() {
+			if selected {
+				iter.err = ErrorInvalidValue.wrap(fmt.Sprintf(
+					"couldn't iterate over the unopened stream %d",
+					stream.Index()))
+			}
+
+			continue
+		}
+
+		iter.streams[stream.Index()] = stream
+		iter.order = append(iter.order, stream)
+	}
+
+	if media.packet == nil {
+		iter.err = ErrorInvalidValue.wrap(
+			"couldn't iterate over the media not opened for decoding")
+	}
+
+	return iter
+}
+
+// Next returns the next decoded frame.
+//
+// When there are no frames anymore, io.EOF is
+// returned. If the context is done, its error
+// is returned. Once Next returns an error,
+// all the subsequent calls return it too.
+func (iter *FrameIterator) Next() (Frame, error) {
+	for iter.err == nil {
+		iter.err = iter.ctx.Err()
+
+		if iter.err != nil {
+			break
+		}
+
+		// Serve all the frames decoded from
+		// the last packet before reading
+		// the next one.
+		if iter.current != nil {
+			frame, ok, err := iter.current.ReadFrame()
+
+			if err != nil {
+				iter.err = err
+				break
+			}
+
+			if ok && frame != nil {
+				return frame, nil
+			}
+
+			iter.current = nil
+		}
+
+		if iter.depleted {
+			if len(iter.flushed) == 0 {
+				iter.err = io.EOF
+				break
+			}
+
+			frame := iter.flushed[0]
+			iter.flushed = iter.flushed[1:]
+
+			return frame, nil
+		}
+
+		packet, ok, err := iter.media.ReadPacket()
+
+		if err != nil {
+			iter.err = err
+			break
+		}
+
+		// Obtain the frames left in the
+		// decoders after the end of the media.
+		if !ok {
+			iter.depleted = true
+
+			for _, stream := range iter.order {
+				frames, err := stream.Flush()
+
+				if err != nil {
+					iter.err = err
+					break
+				}
+
+				iter.flushed = append(iter.flushed, frames...)
+			}
+
+			continue
+		}
+
+		if packet == nil {
+			continue
+		}
+
+		if stream, ok := iter.streams[packet.StreamIndex()]; ok {
+			iter.current = stream
+		}
+	}
+
+	return nil, iter.err
+}
+
+// Err returns the error the iteration stopped
+// with. It returns nil if the iteration is not
+// over or has reached the end of the frames, as
+// bufio.Scanner does.
+func (iter *FrameIterator) Err() error {
+	if iter.err == io.EOF {
+		return nil
+	}
+
+	return iter.err
+}
@@ -0,0 +1,58 @@
+package reisen
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// leakWarnings tells if the objects collected
+// without being closed should be reported.
+var leakWarnings atomic.Bool
+
+// SetLeakWarnings enables or disables the warnings
+// about the media and the streams collected by the
+// garbage collector without being closed. It only
+// affects the objects opened afterwards.
+//
+// The warnings are meant for debugging: they don't
+// free anything, so the objects still must be closed.
+func SetLeakWarnings(enabled bool) {
+	leakWarnings.Store(enabled)
+}
+
+// leakGuard reports the object it's attached
+// to if the object is collected without being
+// closed.
+//
+// The guard doesn't refer to the object, so it
+// becomes unreachable together with the object
+// even if the object belongs to a reference cycle.
+type leakGuard struct {
+	description string
+}
+
+// newLeakGuard returns a new guard for the
+// object or nil if the warnings are disabled.
+func newLeakGuard(description string) *leakGuard {
+	if !leakWarnings.Load() {
+		return nil
+	}
+
+	guard := &leakGuard{description: description}
+	runtime.SetFinalizer(guard, func(guard *leakGuard) {
+		logger().Warn("the object was not closed",
+			"object", guard.description)
+	})
+
+	return guard
+}
+
+// release disarms the guard
+// after the object is closed.
+func (guard *leakGuard) release() {
+	if guard == nil {
+		return
+	}
+
+	runtime.SetFinalizer(guard, nil)
+}
@@ -0,0 +1,175 @@
+package reisen
+
+import (
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// leakRecorder is a logger recording
+// the objects reported as not closed.
+type leakRecorder struct {
+	mutex   sync.Mutex
+	objects []any
+}
+
+func (recorder *leakRecorder) Debug(msg string, args ...any) {}
+func (recorder *leakRecorder) Info(msg string, args ...any)  {}
+func (recorder *leakRecorder) Error(msg string, args ...any) {}
+
+func (recorder *leakRecorder) Warn(msg string, args ...any) {
+	if msg != "the object was not closed" || len(args) < 2 {
+		return
+	}
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.objects = append(recorder.objects, args[1])
+}
+
+// leaks returns the objects
+// reported as not closed.
+func (recorder *leakRecorder) leaks() []any {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	return append([]any(nil), recorder.objects...)
+}
+
+// collect runs the garbage collector several
+// times giving the finalizers time to run.
+func collect() {
+	for i := 0; i < 5; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// openAndClose opens the fixture from the file
+// or from the reader, decodes a few frames and
+// closes everything twice. Then it checks that
+// all the libAV objects have been freed.
+func openAndClose(t *testing.T, path string, fromReader bool) {
+	t.Helper()
+
+	var (
+		media *Media
+		file  *os.File
+		err   error
+	)
+
+	if fromReader {
+		file, err = os.Open(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer file.Close()
+		media, err = NewMediaFromReader(file, "wav")
+	} else {
+		media, err = NewMedia(path)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = media.OpenDecode()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audio := media.AudioStreams()[0]
+	err = audio.Open()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, _, err = audio.ReadAudioFrame()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		err = audio.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		err = media.CloseDecode()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ioCtx := media.io
+	media.Close()
+	media.Close()
+
+	if audio.guard != nil || media.decodeGuard != nil ||
+		media.guard != nil {
+		t.Fatal("the leak guards are not released")
+	}
+
+	if audio.codecCtx != nil || audio.frame != nil ||
+		len(audio.frames) > 0 || len(audio.packets) > 0 ||
+		audio.swrCtx != nil || audio.buffer != nil {
+		t.Fatal("the stream is not freed")
+	}
+
+	if media.ctx != nil || media.packet != nil ||
+		media.io != nil || len(media.filtered) > 0 {
+		t.Fatal("the media is not freed")
+	}
+
+	if ioCtx != nil && (ioCtx.ctx != nil || ioCtx.opaque != nil) {
+		t.Fatal("the I/O context is not freed")
+	}
+}
+
+// TestOpenCloseLoopReleasesResources checks that closing
+// frees the libAV objects held by the media and the
+// stream, and that the leak guards are released. The
+// memory allocated inside libAV itself is not tracked.
+func TestOpenCloseLoopReleasesResources(t *testing.T) {
+	recorder := &leakRecorder{}
+	SetLogger(recorder)
+	defer SetLogger(nil)
+	SetLeakWarnings(true)
+	defer SetLeakWarnings(false)
+
+	path := writeFixture(t)
+
+	for i := 0; i < 50; i++ {
+		openAndClose(t, path, i%2 == 1)
+	}
+
+	collect()
+
+	if leaks := recorder.leaks(); len(leaks) > 0 {
+		t.Fatalf("the objects were not closed: %v", leaks)
+	}
+
+	// Make sure the warnings are really
+	// reported for the objects not closed.
+	newLeakGuard("the control object")
+	collect()
+
+	if leaks := recorder.leaks(); len(leaks) != 1 {
+		t.Fatalf("got %d leaks of the control object, expected 1",
+			len(leaks))
+	}
+}
@@ -0,0 +1,30 @@
+#include <pthread.h>
+#include <stdarg.h>
+#include <libavutil/log.h>
+#include "_cgo_export.h"
+
+// logLineSize is the maximum length
+// of a libAV message passed to Go.
+#define logLineSize 1024
+
+static pthread_mutex_t logMutex = PTHREAD_MUTEX_INITIALIZER;
+static int printPrefix = 1;
+
+// goAVLogCallback formats the libAV message
+// and passes it to the Go logger. The message
+// is formatted the same way the default libAV
+// callback does.
+void goAVLogCallback(void *avcl, int level, const char *fmt, va_list vl) {
+	char line[logLineSize];
+
+	if (level > av_log_get_level()) {
+		return;
+	}
+
+	pthread_mutex_lock(&logMutex);
+	av_log_format_line2(avcl, level, fmt, vl,
+		line, sizeof(line), &printPrefix);
+	pthread_mutex_unlock(&logMutex);
+
+	goAVLog(level, line);
+}
@@ -0,0 +1,132 @@
+package reisen
+
+// #cgo pkg-config: libavutil
+// #include <stdarg.h>
+// #include <libavutil/log.h>
+//
+// extern void goAVLogCallback(void *avcl, int level, const char *fmt, va_list vl);
+import "C"
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Logger receives the diagnostics of the
+// library and the messages of libAV.
+//
+// The arguments are alternating keys
+// and values, so *slog.Logger can be
+// used as a logger.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// loggerHolder wraps the logger
+// to store it atomically.
+type loggerHolder struct {
+	logger Logger
+}
+
+// currentLogger is the logger set with SetLogger.
+// libAV calls the logger from its own threads,
+// so it's accessed atomically.
+var currentLogger atomic.Pointer[loggerHolder]
+
+// SetLogger sets the logger receiving the
+// diagnostics of the library and the messages
+// of libAV. The messages of libAV are filtered
+// by the libAV log level first.
+//
+// A nil logger restores the default behavior:
+// the diagnostics are written with the standard
+// log package (except the debug ones), and libAV
+// writes its messages to stderr.
+func SetLogger(logger Logger) {
+	if logger == nil {
+		currentLogger.Store(nil)
+		C.av_log_set_callback((*[0]byte)(
+			C.av_log_default_callback))
+
+		return
+	}
+
+	currentLogger.Store(&loggerHolder{logger: logger})
+	C.av_log_set_callback((*[0]byte)(C.goAVLogCallback))
+}
+
+// logger returns the current logger.
+func logger() Logger {
+	holder := currentLogger.Load()
+
+	if holder == nil {
+		return defaultLogger{}
+	}
+
+	return holder.logger
+}
+
+// defaultLogger writes the diagnostics
+// with the standard log package.
+type defaultLogger struct{}
+
+// Debug drops the message.
+func (defaultLogger) Debug(msg string, args ...any) {}
+
+// Info writes the informational message.
+func (logger defaultLogger) Info(msg string, args ...any) {
+	logger.print("INFO", msg, args)
+}
+
+// Warn writes the warning.
+func (logger defaultLogger) Warn(msg string, args ...any) {
+	logger.print("WARN", msg, args)
+}
+
+// Error writes the error message.
+func (logger defaultLogger) Error(msg string, args ...any) {
+	logger.print("ERROR", msg, args)
+}
+
+// print writes the message at the
+// level with its key-value pairs.
+func (defaultLogger) print(level, msg string, args []any) {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "reisen: %s %s", level, msg)
+
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&builder, " %v=%v", args[i], args[i+1])
+	}
+
+	log.Print(builder.String())
+}
+
+//export goAVLog
+func goAVLog(level C.int, line *C.char) {
+	msg := strings.TrimSpace(C.GoString(line))
+
+	if msg == "" {
+		return
+	}
+
+	logger := logger()
+
+	switch {
+	case level <= C.AV_LOG_ERROR:
+		logger.Error(msg, "source", "libav")
+
+	case level <= C.AV_LOG_WARNING:
+		logger.Warn(msg, "source", "libav")
+
+	case level <= C.AV_LOG_INFO:
+		logger.Info(msg, "source", "libav")
+
+	default:
+		logger.Debug(msg, "source", "libav")
+	}
+}
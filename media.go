@@ -9,6 +9,7 @@ package reisen
 import "C"
 import (
 	"fmt"
+	"io"
 	"time"
 	"unsafe"
 )
@@ -16,9 +17,18 @@ import (
 // Media is a media file containing
 // audio, video and other types of streams.
 type Media struct {
-	ctx     *C.AVFormatContext
-	packet  *C.AVPacket
-	streams []Stream
+	ctx            *C.AVFormatContext
+	io             *ioContext
+	packet         *C.AVPacket
+	pending        bool
+	filtered       []*C.AVPacket
+	filtersDrained bool
+	manual         bool
+	queuedSize     int64
+	queueLimit     int64
+	streams        []Stream
+	guard          *leakGuard
+	decodeGuard    *leakGuard
 }
 
 // StreamCount returns the number of streams.
@@ -80,11 +90,16 @@ func (media *Media) DataStreamsByCodecTag(codecTag int) []*DataStream {
 
 // Duration returns the overall duration
 // of the media file.
+//
+// ErrNoTimestamp is returned if
+// the duration is unknown.
 func (media *Media) Duration() (time.Duration, error) {
-	dur := media.ctx.duration
-	tm := float64(dur) / float64(TimeBase)
+	if media.ctx.duration == noTimestamp {
+		return 0, ErrNoTimestamp
+	}
 
-	return time.ParseDuration(fmt.Sprintf("%fs", tm))
+	return timestampToDuration(media.ctx.duration,
+		globalTimeBase()), nil
 }
 
 // FormatName returns the name of the media format.
@@ -116,6 +131,25 @@ func (media *Media) FormatMIMEType() string {
 	return C.GoString(media.ctx.iformat.mime_type)
 }
 
+// Metadata returns the metadata
+// tags of the media container.
+func (media *Media) Metadata() map[string]string {
+	return dictionaryEntries(media.ctx.metadata)
+}
+
+// CreationTime returns the time the media
+// was created at according to its metadata.
+func (media *Media) CreationTime() (time.Time, bool) {
+	return creationTime(media.Metadata())
+}
+
+// Encoder returns the name of the encoder
+// the media was produced with or "" if
+// it's unknown.
+func (media *Media) Encoder() string {
+	return media.Metadata()[TagEncoder]
+}
+
 // findStreams retrieves the stream information
 // from the media container.
 func (media *Media) findStreams() error {
@@ -125,7 +159,7 @@ func (media *Media) findStreams() error {
 	status := C.avformat_find_stream_info(media.ctx, nil)
 
 	if status < 0 {
-		return fmt.Errorf(
+		return newAVError(status,
 			"couldn't find stream information")
 	}
 
@@ -134,9 +168,9 @@ func (media *Media) findStreams() error {
 		codec := C.avcodec_find_decoder(codecParams.codec_id)
 
 		if codec == nil {
-			fmt.Printf(
-				"couldn't find codec by ID = %d\n",
-				codecParams.codec_id)
+			logger().Warn("couldn't find the codec",
+				"stream", int(innerStream.index),
+				"codec_id", int(codecParams.codec_id))
 		}
 
 		switch codecParams.codec_type {
@@ -167,7 +201,9 @@ func (media *Media) findStreams() error {
 			gStream.media = media
 			streams = append(streams, gStream)
 		default:
-			fmt.Printf("unknown stream type %d\n", codecParams.codec_type)
+			logger().Debug("unknown stream type",
+				"stream", int(innerStream.index),
+				"type", int(codecParams.codec_type))
 		}
 	}
 
@@ -180,108 +216,330 @@ func (media *Media) findStreams() error {
 //
 // CloseDecode() should be called afterwards.
 func (media *Media) OpenDecode() error {
+	if media.packet != nil {
+		return nil
+	}
+
 	media.packet = C.av_packet_alloc()
 
 	if media.packet == nil {
-		return fmt.Errorf(
+		return ErrorNoMemory.wrap(
 			"couldn't allocate a new packet")
 	}
 
+	media.decodeGuard = newLeakGuard(
+		"the decoding of the media")
+
 	return nil
 }
 
 // ReadPacket reads the next packet from the media stream.
+//
+// After it's called, the streams don't read packets
+// on their own until the media is sought, and the
+// packet should be decoded by its stream with
+// ReadFrame before the next one is read. When
+// there are no packets anymore, the frames still
+// buffered inside the decoders should be obtained
+// with Flush() of every opened stream.
+//
+// A bitstream filter applied to a stream can
+// produce several packets from one or none at
+// all. In the latter case the returned packet
+// is nil, and the reading should go on.
 func (media *Media) ReadPacket() (*Packet, bool, error) {
+	media.manual = true
+	ok, err := media.readPacket()
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !ok || !media.pending {
+		return nil, ok, nil
+	}
+
+	index := int(media.packet.stream_index)
+
+	return newPacket(media, media.pendingPacket(index)), true, nil
+}
+
+// readPacket reads the next packet from the
+// media stream and filters it if needed. The
+// packet stays pending until its stream
+// decodes it or the next packet is read.
+//
+// If the bitstream filter of the stream needs
+// more packets, no packet is pending.
+func (media *Media) readPacket() (bool, error) {
+	// The previous packet is dropped
+	// if no stream has decoded it.
+	media.releasePacket()
+
+	// The packets produced by the
+	// filters earlier come first.
+	if len(media.filtered) > 0 {
+		media.popFiltered()
+		return true, nil
+	}
+
 	status := C.av_read_frame(media.ctx, media.packet)
 
 	if status < 0 {
 		if status == C.int(ErrorAgain) {
-			return nil, true, nil
+			return true, nil
+		}
+
+		if status != C.int(ErrorEndOfFile) {
+			return false, newAVError(status,
+				"couldn't read the packet")
+		}
+
+		// Obtain the packets
+		// left in the filters.
+		err := media.drainFilters()
+
+		if err != nil {
+			return false, err
 		}
 
 		// No packets anymore.
-		return nil, false, nil
+		if len(media.filtered) == 0 {
+			return false, nil
+		}
+
+		media.popFiltered()
+
+		return true, nil
 	}
 
 	// Filter the packet if needed.
 	packetStream := media.streams[media.packet.stream_index]
-	outPacket := media.packet
 
-	if packetStream.filter() != nil {
-		filter := packetStream.filter()
-		packetIn := packetStream.filterIn()
-		packetOut := packetStream.filterOut()
+	if packetStream.filter() == nil {
+		media.pending = true
+		return true, nil
+	}
 
-		status = C.av_packet_ref(packetIn, media.packet)
+	err := media.filterPacket(packetStream)
 
-		if status < 0 {
-			return nil, false,
-				fmt.Errorf("%d: couldn't reference the packet",
-					status)
-		}
+	if err != nil {
+		return false, err
+	}
 
-		status = C.av_bsf_send_packet(filter, packetIn)
+	if len(media.filtered) > 0 {
+		media.popFiltered()
+	}
 
-		if status < 0 {
-			return nil, false,
-				fmt.Errorf("%d: couldn't send the packet to the filter",
-					status)
-		}
+	return true, nil
+}
 
-		status = C.av_bsf_receive_packet(filter, packetOut)
+// pendingPacket returns the packet read last
+// if it belongs to the stream with the specified
+// index and hasn't been decoded yet, and nil
+// otherwise.
+func (media *Media) pendingPacket(index int) *C.AVPacket {
+	if !media.pending || int(media.packet.
+		stream_index) != index {
+		return nil
+	}
 
-		if status < 0 {
-			return nil, false,
-				fmt.Errorf("%d: couldn't receive the packet from the filter",
-					status)
-		}
+	return media.packet
+}
 
-		outPacket = packetOut
+// releasePacket releases the data
+// of the packet read last.
+func (media *Media) releasePacket() {
+	if !media.pending {
+		return
 	}
 
-	return newPacket(media, outPacket), true, nil
+	C.av_packet_unref(media.packet)
+	media.pending = false
 }
 
 // CloseDecode closes the media container for decoding.
+//
+// It's safe to call it several times.
 func (media *Media) CloseDecode() error {
-	C.av_free(unsafe.Pointer(media.packet))
-	media.packet = nil
+	if media.packet == nil {
+		return nil
+	}
+
+	media.releasePacket()
+	media.discardFiltered()
+	C.av_packet_free(&media.packet)
+	media.decodeGuard.release()
+	media.decodeGuard = nil
 
 	return nil
 }
 
-// Close closes the media container.
+// Close closes the media container. The streams
+// and the decoding of the media are closed too.
+//
+// It's safe to call it several times.
 func (media *Media) Close() {
-	C.avformat_free_context(media.ctx)
-	media.ctx = nil
+	if media.ctx == nil {
+		return
+	}
+
+	for _, stream := range media.streams {
+		stream.Close()
+	}
+
+	media.CloseDecode()
+	C.avformat_close_input(&media.ctx)
+
+	// libAV doesn't free the
+	// custom I/O context.
+	if media.io != nil {
+		media.io.free()
+		media.io = nil
+	}
+
+	media.guard.release()
+	media.guard = nil
 }
 
 // NewMedia returns a new media container analyzer
 // for the specified media file.
-func NewMedia(filename string) (*Media, error) {
+//
+// The options are passed to the demuxer,
+// e.g. "probesize" or "ignore_editlist".
+func NewMedia(filename string, options ...Options) (*Media, error) {
+	opts := mergeOptions(options)
+	format, err := opts.inputFormat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	dict, err := opts.demuxerDictionary()
+
+	if err != nil {
+		return nil, err
+	}
+
 	media := &Media{
 		ctx: C.avformat_alloc_context(),
 	}
 
 	if media.ctx == nil {
-		return nil, fmt.Errorf(
+		C.av_dict_free(&dict)
+
+		return nil, ErrorNoMemory.wrap(
 			"couldn't create a new media context")
 	}
 
 	fname := C.CString(filename)
-	status := C.avformat_open_input(&media.ctx, fname, nil, nil)
+	status := C.avformat_open_input(&media.ctx, fname, format, &dict)
+	C.free(unsafe.Pointer(fname))
 
 	if status < 0 {
-		return nil, fmt.Errorf(
-			"couldn't open file %s", filename)
+		// The media context is
+		// freed by libAV on failure.
+		C.av_dict_free(&dict)
+
+		return nil, newAVError(status,
+			fmt.Sprintf("couldn't open file %s", filename))
 	}
 
-	C.free(unsafe.Pointer(fname))
-	err := media.findStreams()
+	err = checkConsumed(dict)
+
+	if err != nil {
+		media.Close()
+		return nil, err
+	}
+
+	err = media.findStreams()
+
+	if err != nil {
+		media.Close()
+		return nil, err
+	}
+
+	media.guard = newLeakGuard(
+		fmt.Sprintf("the media %s", filename))
+
+	return media, nil
+}
+
+// NewMediaFromReader returns a new media container
+// analyzer reading the media data from the source.
+//
+// The format hint is the short name of the container
+// format (e.g. "mov"). If it's empty, the format is
+// probed from the data. The source must remain valid
+// until the media is closed.
+func NewMediaFromReader(source io.ReadSeeker, formatHint string, options ...Options) (*Media, error) {
+	opts := mergeOptions(options)
+
+	if formatHint != "" {
+		opts[formatOption] = formatHint
+	}
+
+	format, err := opts.inputFormat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	dict, err := opts.demuxerDictionary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ioCtx, err := newIOContext(source)
 
 	if err != nil {
+		C.av_dict_free(&dict)
 		return nil, err
 	}
 
+	media := &Media{
+		ctx: C.avformat_alloc_context(),
+		io:  ioCtx,
+	}
+
+	if media.ctx == nil {
+		C.av_dict_free(&dict)
+		ioCtx.free()
+
+		return nil, ErrorNoMemory.wrap(
+			"couldn't create a new media context")
+	}
+
+	media.ctx.pb = ioCtx.ctx
+	status := C.avformat_open_input(&media.ctx, nil, format, &dict)
+
+	if status < 0 {
+		// The media context is
+		// freed by libAV on failure.
+		C.av_dict_free(&dict)
+		ioCtx.free()
+
+		return nil, newAVError(status,
+			"couldn't open the media source")
+	}
+
+	err = checkConsumed(dict)
+
+	if err != nil {
+		media.Close()
+		return nil, err
+	}
+
+	err = media.findStreams()
+
+	if err != nil {
+		media.Close()
+		return nil, err
+	}
+
+	media.guard = newLeakGuard(
+		"the media read from a Go reader")
+
 	return media, nil
 }
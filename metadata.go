@@ -0,0 +1,37 @@
+package reisen
+
+import "time"
+
+const (
+	// TagCreationTime is the metadata tag keeping
+	// the time the media or the stream was created.
+	TagCreationTime = "creation_time"
+	// TagHandlerName is the metadata tag keeping
+	// the name of the stream handler, e.g.
+	// "GoPro AVC" or "GoPro MET".
+	TagHandlerName = "handler_name"
+	// TagEncoder is the metadata tag keeping
+	// the name of the media encoder.
+	TagEncoder = "encoder"
+	// TagLanguage is the metadata tag keeping
+	// the language of the stream.
+	TagLanguage = "language"
+)
+
+// creationTime parses the creation
+// time from the metadata tags.
+func creationTime(metadata map[string]string) (time.Time, bool) {
+	value, ok := metadata[TagCreationTime]
+
+	if !ok {
+		return time.Time{}, false
+	}
+
+	tm, err := time.Parse(time.RFC3339Nano, value)
+
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return tm, true
+}
@@ -0,0 +1,159 @@
+package reisen
+
+// #cgo pkg-config: libavformat libavutil
+// #include <stdlib.h>
+// #include <libavformat/avformat.h>
+// #include <libavutil/dict.h>
+import "C"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// formatOption is the name of the option
+// forcing the input format of the media.
+const formatOption = "format"
+
+// Options is a set of libAV options passed
+// to the demuxer or to the decoder, e.g.
+// "probesize", "analyzeduration", "threads"
+// or "skip_frame".
+//
+// The "format" option of the media forces
+// the input format by its short name
+// (e.g. "mov") instead of probing it.
+type Options map[string]string
+
+// dictionary converts the options
+// to a new libAV dictionary.
+//
+// The dictionary should be freed
+// with av_dict_free afterwards.
+func (options Options) dictionary() (*C.AVDictionary, error) {
+	var dict *C.AVDictionary
+
+	for key, value := range options {
+		cKey := C.CString(key)
+		cValue := C.CString(value)
+		status := C.av_dict_set(&dict, cKey, cValue, 0)
+
+		C.free(unsafe.Pointer(cKey))
+		C.free(unsafe.Pointer(cValue))
+
+		if status < 0 {
+			C.av_dict_free(&dict)
+
+			return nil, newAVError(status,
+				fmt.Sprintf("couldn't set the option %s", key))
+		}
+	}
+
+	return dict, nil
+}
+
+// demuxerDictionary converts the options
+// to a new libAV dictionary for the demuxer.
+// The format option is not passed to it.
+func (options Options) demuxerDictionary() (*C.AVDictionary, error) {
+	demuxerOptions := Options{}
+
+	for key, value := range options {
+		if key != formatOption {
+			demuxerOptions[key] = value
+		}
+	}
+
+	return demuxerOptions.dictionary()
+}
+
+// inputFormat returns the input format
+// forced by the options or nil if the
+// format should be probed.
+func (options Options) inputFormat() (*C.AVInputFormat, error) {
+	name, ok := options[formatOption]
+
+	if !ok || name == "" {
+		return nil, nil
+	}
+
+	return findInputFormat(name)
+}
+
+// findInputFormat finds the input
+// format by its short name.
+func findInputFormat(name string) (*C.AVInputFormat, error) {
+	cName := C.CString(name)
+	format := C.av_find_input_format(cName)
+	C.free(unsafe.Pointer(cName))
+
+	if format == nil {
+		return nil, ErrorDemuxerNotFound.wrap(fmt.Sprintf(
+			"couldn't find the media format %s", name))
+	}
+
+	return format, nil
+}
+
+// mergeOptions merges the sets of options
+// into one. The latter sets take precedence.
+func mergeOptions(sets []Options) Options {
+	options := Options{}
+
+	for _, set := range sets {
+		for key, value := range set {
+			options[key] = value
+		}
+	}
+
+	return options
+}
+
+// dictionaryEntries returns all the
+// entries of the libAV dictionary.
+func dictionaryEntries(dict *C.AVDictionary) map[string]string {
+	entries := map[string]string{}
+	empty := C.CString("")
+	defer C.free(unsafe.Pointer(empty))
+
+	var entry *C.AVDictionaryEntry
+
+	for {
+		entry = C.av_dict_get(dict, empty,
+			entry, C.AV_DICT_IGNORE_SUFFIX)
+
+		if entry == nil {
+			break
+		}
+
+		entries[C.GoString(entry.key)] =
+			C.GoString(entry.value)
+	}
+
+	return entries
+}
+
+// checkConsumed frees the dictionary returned
+// by libAV and reports an error if some of the
+// options were not recognized.
+func checkConsumed(dict *C.AVDictionary) error {
+	entries := dictionaryEntries(dict)
+	C.av_dict_free(&dict)
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(entries))
+
+	for key := range entries {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return ErrorOptionNotFound.wrap(fmt.Sprintf(
+		"couldn't recognize the options %s",
+		strings.Join(keys, ", ")))
+}
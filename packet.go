@@ -53,6 +53,47 @@ func (pkt *Packet) Size() int {
 	return pkt.size
 }
 
+// PTS returns the presentation timestamp of
+// the packet in the time base units of its
+// stream or NoTimestamp if it's unknown.
+func (pkt *Packet) PTS() int64 {
+	return pkt.pts
+}
+
+// DTS returns the decoding timestamp of
+// the packet in the time base units of
+// its stream or NoTimestamp if it's
+// unknown.
+func (pkt *Packet) DTS() int64 {
+	return pkt.dts
+}
+
+// Duration returns the duration of the
+// packet in the time base units of its
+// stream or 0 if it's unknown.
+func (pkt *Packet) Duration() int64 {
+	return pkt.duration
+}
+
+// Pos returns the byte position of the
+// packet in the media or -1 if it's
+// unknown.
+func (pkt *Packet) Pos() int64 {
+	return pkt.pos
+}
+
+// IsKeyframe returns 'true' if
+// the packet contains a keyframe.
+func (pkt *Packet) IsKeyframe() bool {
+	return pkt.flags&C.AV_PKT_FLAG_KEY != 0
+}
+
+// TimeBase returns the time base
+// of the packet timestamps.
+func (pkt *Packet) TimeBase() Rational {
+	return pkt.media.streams[pkt.streamIndex].TimeBaseRational()
+}
+
 // newPacket creates a
 // new packet info object.
 func newPacket(media *Media, cPkt *C.AVPacket) *Packet {
@@ -0,0 +1,275 @@
+package reisen
+
+// #cgo pkg-config: libavcodec
+// #include <libavcodec/avcodec.h>
+import "C"
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultPipelineBuffer is the default capacity of
+// the packet and frame channels of the pipeline.
+const DefaultPipelineBuffer = 16
+
+// Pipeline decodes the streams of the media
+// concurrently. The packets are demuxed on one
+// goroutine, and every stream is decoded on its
+// own one delivering the frames over a bounded
+// channel.
+//
+// Since the channels are bounded, the frames of
+// all the streams should be consumed concurrently,
+// otherwise the pipeline stalls waiting for the
+// stream which is not read.
+type Pipeline struct {
+	cancel  context.CancelFunc
+	media   *Media
+	streams []Stream
+	frames  map[int]chan Frame
+	errs    chan error
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewPipeline starts decoding the specified
+// streams of the media concurrently. If no
+// streams are specified, all the opened
+// streams are decoded.
+//
+// The buffer is the capacity of the channels
+// of every stream. If it's not positive, the
+// default one is used.
+//
+// The media must be opened for decoding, and the
+// streams must be opened beforehand. The media
+// must not be read by other means until the
+// pipeline is finished. Afterwards the streams
+// read the packets on their own again.
+func NewPipeline(ctx context.Context, media *Media, buffer int, streams ...Stream) (*Pipeline, error) {
+	if media.packet == nil {
+		return nil, ErrorInvalidValue.wrap(
+			"couldn't decode the media not opened for decoding")
+	}
+
+	if buffer <= 0 {
+		buffer = DefaultPipelineBuffer
+	}
+
+	selected := len(streams) > 0
+
+	if !selected {
+		streams = media.streams
+	}
+
+	decoded := []Stream{}
+
+	for _, stream := range streams {
+		if !stream.Opened() {
+			if selected {
+				return nil, ErrorInvalidValue.wrap(fmt.Sprintf(
+					"couldn't decode the unopened stream %d",
+					stream.Index()))
+			}
+
+			continue
+		}
+
+		decoded = append(decoded, stream)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pipeline := &Pipeline{
+		cancel:  cancel,
+		media:   media,
+		streams: decoded,
+		frames:  map[int]chan Frame{},
+		errs:    make(chan error, len(decoded)+1),
+		done:    make(chan struct{}),
+	}
+	feeds := map[int]chan *C.AVPacket{}
+
+	// The packets are dispatched
+	// by the pipeline only.
+	media.manual = true
+	media.releasePacket()
+
+	for _, stream := range decoded {
+		feed := make(chan *C.AVPacket, buffer)
+		frames := make(chan Frame, buffer)
+
+		feeds[stream.Index()] = feed
+		pipeline.frames[stream.Index()] = frames
+		stream.setFeed(feed)
+	}
+
+	pipeline.wg.Add(len(decoded) + 1)
+	go pipeline.demux(ctx, media, feeds)
+
+	for _, stream := range decoded {
+		go pipeline.decode(ctx, stream,
+			feeds[stream.Index()],
+			pipeline.frames[stream.Index()])
+	}
+
+	go pipeline.finish()
+
+	return pipeline, nil
+}
+
+// Frames returns the channel of the frames
+// decoded from the stream or nil if the
+// stream is not decoded by the pipeline.
+//
+// The channel is closed when the stream
+// is depleted or the pipeline is stopped.
+func (pipeline *Pipeline) Frames(stream Stream) <-chan Frame {
+	frames, ok := pipeline.frames[stream.Index()]
+
+	if !ok {
+		return nil
+	}
+
+	return frames
+}
+
+// Errors returns the channel of the errors
+// the pipeline stopped with. It's closed
+// when the pipeline is finished.
+func (pipeline *Pipeline) Errors() <-chan error {
+	return pipeline.errs
+}
+
+// Stop cancels decoding and waits
+// until the pipeline is finished.
+// The media and the streams can be
+// closed afterwards.
+func (pipeline *Pipeline) Stop() {
+	pipeline.cancel()
+	<-pipeline.done
+}
+
+// finish waits for the goroutines of
+// the pipeline and makes the streams
+// read the packets on their own again.
+func (pipeline *Pipeline) finish() {
+	pipeline.wg.Wait()
+	pipeline.cancel()
+
+	for _, stream := range pipeline.streams {
+		stream.setFeed(nil)
+	}
+
+	pipeline.media.manual = false
+	close(pipeline.errs)
+	close(pipeline.done)
+}
+
+// fail reports the error
+// and stops the pipeline.
+func (pipeline *Pipeline) fail(err error) {
+	// Every goroutine reports at most
+	// one error, so the channel
+	// never blocks.
+	pipeline.errs <- err
+	pipeline.cancel()
+}
+
+// demux reads the packets of the media
+// and dispatches them to the streams.
+func (pipeline *Pipeline) demux(ctx context.Context, media *Media, feeds map[int]chan *C.AVPacket) {
+	defer pipeline.wg.Done()
+
+	// The streams reach the end of the
+	// media when their feeds are closed.
+	defer func() {
+		for _, feed := range feeds {
+			close(feed)
+		}
+	}()
+
+	for ctx.Err() == nil {
+		ok, err := media.readPacket()
+
+		if err != nil {
+			pipeline.fail(err)
+			return
+		}
+
+		if !ok {
+			return
+		}
+
+		if !media.pending {
+			continue
+		}
+
+		index := int(media.packet.stream_index)
+		feed, ok := feeds[index]
+
+		if !ok {
+			media.releasePacket()
+			continue
+		}
+
+		packet := C.av_packet_alloc()
+
+		if packet == nil {
+			media.releasePacket()
+			pipeline.fail(ErrorNoMemory.wrap(
+				"couldn't allocate a packet to dispatch"))
+
+			return
+		}
+
+		C.av_packet_move_ref(packet, media.pendingPacket(index))
+		media.releasePacket()
+
+		select {
+		case feed <- packet:
+		case <-ctx.Done():
+			C.av_packet_free(&packet)
+			return
+		}
+	}
+}
+
+// decode decodes the packets of the stream
+// received from the feed and delivers the
+// frames to the channel.
+func (pipeline *Pipeline) decode(ctx context.Context, stream Stream, feed <-chan *C.AVPacket, frames chan<- Frame) {
+	defer pipeline.wg.Done()
+	defer close(frames)
+
+	// Free the packets left after
+	// the pipeline has been stopped.
+	defer func() {
+		for packet := range feed {
+			C.av_packet_free(&packet)
+		}
+	}()
+
+	for ctx.Err() == nil {
+		frame, ok, err := stream.ReadFrame()
+
+		if err != nil {
+			pipeline.fail(err)
+			return
+		}
+
+		if !ok {
+			return
+		}
+
+		if frame == nil {
+			continue
+		}
+
+		select {
+		case frames <- frame:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package reisen
+
+// #cgo pkg-config: libavutil
+// #include <libavutil/pixdesc.h>
+// #include <libavutil/pixfmt.h>
+import "C"
+
+// PixelFormat is a pixel format
+// of the decoded video frames.
+type PixelFormat int
+
+const (
+	// PixelFormatRGBA is a packed 32-bit
+	// RGBA format (*image.RGBA).
+	PixelFormatRGBA PixelFormat = iota
+	// PixelFormatRGB24 is a packed
+	// 24-bit RGB format (*RGB).
+	PixelFormatRGB24
+	// PixelFormatGray8 is an 8-bit
+	// luma only format (*image.Gray).
+	PixelFormatGray8
+	// PixelFormatYUV420P is a planar YUV 4:2:0
+	// format (*image.YCbCr).
+	PixelFormatYUV420P
+	// PixelFormatNV12 is a YUV 4:2:0 format with
+	// a luma plane and an interleaved chroma
+	// plane (*NV12).
+	PixelFormatNV12
+	// PixelFormatNative keeps the frames in the
+	// format of the decoder without converting
+	// or scaling them.
+	PixelFormatNative
+	// PixelFormatRGBA64 is a packed 64-bit RGBA
+	// format (*image.RGBA64) keeping the precision
+	// of the high bit depth video.
+	PixelFormatRGBA64
+	// PixelFormatGray16 is a 16-bit luma
+	// only format (*image.Gray16).
+	PixelFormatGray16
+)
+
+// String returns the name of the pixel format.
+func (format PixelFormat) String() string {
+	switch format {
+	case PixelFormatRGBA:
+		return "rgba"
+
+	case PixelFormatRGB24:
+		return "rgb24"
+
+	case PixelFormatGray8:
+		return "gray8"
+
+	case PixelFormatYUV420P:
+		return "yuv420p"
+
+	case PixelFormatNV12:
+		return "nv12"
+
+	case PixelFormatNative:
+		return "native"
+
+	case PixelFormatRGBA64:
+		return "rgba64"
+
+	case PixelFormatGray16:
+		return "gray16"
+
+	default:
+		return ""
+	}
+}
+
+// av returns the libAV pixel format or
+// AV_PIX_FMT_NONE for the native one.
+func (format PixelFormat) av() C.enum_AVPixelFormat {
+	switch format {
+	case PixelFormatRGBA:
+		return C.AV_PIX_FMT_RGBA
+
+	case PixelFormatRGB24:
+		return C.AV_PIX_FMT_RGB24
+
+	case PixelFormatGray8:
+		return C.AV_PIX_FMT_GRAY8
+
+	case PixelFormatYUV420P:
+		return C.AV_PIX_FMT_YUV420P
+
+	case PixelFormatNV12:
+		return C.AV_PIX_FMT_NV12
+
+	// The big-endian formats match the
+	// layout of the Go 16-bit images.
+	case PixelFormatRGBA64:
+		return C.AV_PIX_FMT_RGBA64BE
+
+	case PixelFormatGray16:
+		return C.AV_PIX_FMT_GRAY16BE
+
+	default:
+		return C.AV_PIX_FMT_NONE
+	}
+}
+
+// pixelFormatName returns the name
+// of the libAV pixel format.
+func pixelFormatName(format C.enum_AVPixelFormat) string {
+	name := C.av_get_pix_fmt_name(format)
+
+	if name == nil {
+		return ""
+	}
+
+	return C.GoString(name)
+}
@@ -0,0 +1,203 @@
+package reisen
+
+// #cgo pkg-config: libavcodec
+// #include <libavcodec/avcodec.h>
+import "C"
+import "errors"
+
+// DefaultPacketQueueLimit is the default limit
+// of the total size (in bytes) of the packets
+// parked for the streams of the media.
+const DefaultPacketQueueLimit = 64 * 1024 * 1024
+
+// ErrPacketQueueFull is returned when reading
+// a stream requires parking more packets of
+// the other streams than the limit allows.
+//
+// The packet which doesn't fit is kept, so no
+// data is lost: the other streams should be
+// read to free the queue before reading the
+// stream again.
+var ErrPacketQueueFull = errors.New(
+	"the packet queue limit is exceeded")
+
+// SetPacketQueueLimit sets the limit of the total
+// size (in bytes) of the packets parked for the
+// opened streams while another stream is read.
+//
+// A negative limit disables the check,
+// and zero restores the default limit.
+// When the limit is exceeded, reading
+// fails with ErrPacketQueueFull.
+func (media *Media) SetPacketQueueLimit(limit int) {
+	media.queueLimit = int64(limit)
+}
+
+// QueuedPacketsSize returns the total size
+// (in bytes) of the packets parked for the
+// streams of the media.
+func (media *Media) QueuedPacketsSize() int {
+	return int(media.queuedSize)
+}
+
+// packetQueueLimit returns the actual limit
+// of the total size of the parked packets.
+func (media *Media) packetQueueLimit() int64 {
+	if media.queueLimit == 0 {
+		return DefaultPacketQueueLimit
+	}
+
+	return media.queueLimit
+}
+
+// park moves the pending packet to the queue
+// of the stream with the specified index. If
+// the packet is limited, it stays pending when
+// the queues are full.
+func (media *Media) park(index int, limited bool) error {
+	packet := media.pendingPacket(index)
+	size := int64(packet.size)
+	limit := media.packetQueueLimit()
+
+	if limited && limit > 0 && media.queuedSize+size > limit {
+		return ErrPacketQueueFull
+	}
+
+	parked := C.av_packet_alloc()
+
+	if parked == nil {
+		media.releasePacket()
+
+		return ErrorNoMemory.wrap(
+			"couldn't allocate a packet to park")
+	}
+
+	C.av_packet_move_ref(parked, packet)
+	media.releasePacket()
+	media.streams[index].enqueue(parked)
+	media.queuedSize += size
+
+	return nil
+}
+
+// demux reads the packets of the media until one
+// of the stream with the specified index is parked.
+// The packets of the other opened streams are parked
+// for them, and the rest are dropped.
+//
+// The packet left pending when the queues were
+// full is parked first.
+//
+// It returns 'false' if the end of the media is reached.
+func (media *Media) demux(index int) (bool, error) {
+	for {
+		if !media.pending {
+			ok, err := media.readPacket()
+
+			if err != nil {
+				return false, err
+			}
+
+			if !ok {
+				return false, nil
+			}
+
+			if !media.pending {
+				continue
+			}
+		}
+
+		packetIndex := int(media.packet.stream_index)
+
+		if !media.streams[packetIndex].Opened() {
+			media.releasePacket()
+			continue
+		}
+
+		err := media.park(packetIndex, packetIndex != index)
+
+		if err != nil {
+			return false, err
+		}
+
+		if packetIndex == index {
+			return true, nil
+		}
+	}
+}
+
+// enqueue parks the packet
+// for decoding it later.
+func (stream *baseStream) enqueue(packet *C.AVPacket) {
+	stream.packets = append(stream.packets, packet)
+}
+
+// parkPending parks the pending packet of
+// the stream, so the media can read the
+// next one.
+func (stream *baseStream) parkPending() error {
+	if stream.feed != nil ||
+		stream.media.pendingPacket(stream.Index()) == nil {
+		return nil
+	}
+
+	return stream.media.park(stream.Index(), false)
+}
+
+// setFeed makes the stream receive the packets
+// from the channel instead of the media. A nil
+// channel restores reading from the media.
+func (stream *baseStream) setFeed(feed <-chan *C.AVPacket) {
+	stream.feed = feed
+}
+
+// nextPacket returns the oldest packet parked
+// for the stream. If there are no packets, and
+// the packets are not dispatched by the caller
+// with ReadPacket, the media is demuxed until
+// the packet of the stream is parked.
+//
+// If the stream has a feed, the packet is
+// received from it instead, and its closing
+// means the end of the media.
+//
+// It returns nil if no packet is available and
+// 'false' if the end of the media is reached.
+// The packet should be freed afterwards.
+func (stream *baseStream) nextPacket() (*C.AVPacket, bool, error) {
+	if stream.feed != nil {
+		packet, ok := <-stream.feed
+
+		return packet, ok, nil
+	}
+
+	if len(stream.packets) == 0 {
+		if stream.media.manual {
+			return nil, true, nil
+		}
+
+		ok, err := stream.media.demux(stream.Index())
+
+		if err != nil || !ok {
+			return nil, ok, err
+		}
+	}
+
+	packet := stream.packets[0]
+	stream.packets[0] = nil
+	stream.packets = stream.packets[1:]
+	stream.media.queuedSize -= int64(packet.size)
+
+	return packet, true, nil
+}
+
+// discardPackets frees all the
+// packets parked for the stream.
+func (stream *baseStream) discardPackets() {
+	for i := range stream.packets {
+		stream.media.queuedSize -= int64(stream.packets[i].size)
+		C.av_packet_free(&stream.packets[i])
+	}
+
+	stream.packets = nil
+}
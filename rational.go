@@ -0,0 +1,91 @@
+package reisen
+
+// #cgo pkg-config: libavutil
+// #include <libavutil/avutil.h>
+import "C"
+import (
+	"fmt"
+	"time"
+)
+
+// Rational is a rational number libAV
+// describes time bases and frame
+// rates with.
+type Rational struct {
+	Num int
+	Den int
+}
+
+// newRational converts the
+// libAV rational to Rational.
+func newRational(r C.AVRational) Rational {
+	return Rational{
+		Num: int(r.num),
+		Den: int(r.den),
+	}
+}
+
+// av converts the rational
+// to the libAV one.
+func (r Rational) av() C.AVRational {
+	return C.AVRational{
+		num: C.int(r.Num),
+		den: C.int(r.Den),
+	}
+}
+
+// Valid returns 'true' if the
+// denominator of the rational
+// is not zero.
+func (r Rational) Valid() bool {
+	return r.Den != 0
+}
+
+// Float64 returns the value of the
+// rational or 0 if it's not valid.
+func (r Rational) Float64() float64 {
+	if !r.Valid() {
+		return 0
+	}
+
+	return float64(r.Num) / float64(r.Den)
+}
+
+// String returns the string
+// representation of the rational.
+func (r Rational) String() string {
+	return fmt.Sprintf("%d/%d", r.Num, r.Den)
+}
+
+// Rescale converts the value in the units
+// of the rational to the units of the other
+// one without losing precision. The unknown
+// timestamp is kept as is.
+func (r Rational) Rescale(value int64, to Rational) int64 {
+	if value == NoTimestamp {
+		return NoTimestamp
+	}
+
+	return int64(C.av_rescale_q(C.int64_t(value), r.av(), to.av()))
+}
+
+// Duration converts the timestamp in the units
+// of the rational (i.e. the time base) to the
+// time duration.
+//
+// ErrNoTimestamp is returned if the
+// timestamp is unknown.
+func (r Rational) Duration(ts int64) (time.Duration, error) {
+	if ts == NoTimestamp {
+		return 0, ErrNoTimestamp
+	}
+
+	return timestampToDuration(C.int64_t(ts), r.av()), nil
+}
+
+// Timestamp converts the time duration to the
+// timestamp in the units of the rational (i.e.
+// the time base).
+func (r Rational) Timestamp(t time.Duration) int64 {
+	return int64(durationToTimestamp(t, r.av()))
+}
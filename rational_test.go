@@ -0,0 +1,102 @@
+package reisen
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRationalValue(t *testing.T) {
+	tests := []struct {
+		r      Rational
+		valid  bool
+		value  float64
+		string string
+	}{
+		{Rational{1, 25}, true, 0.04, "1/25"},
+		{Rational{30000, 1001}, true, 30000.0 / 1001, "30000/1001"},
+		{Rational{0, 1}, true, 0, "0/1"},
+		{Rational{1, 0}, false, 0, "1/0"},
+		{Rational{}, false, 0, "0/0"},
+	}
+
+	for _, test := range tests {
+		if valid := test.r.Valid(); valid != test.valid {
+			t.Errorf("%v: got valid %t, expected %t",
+				test.r, valid, test.valid)
+		}
+
+		if value := test.r.Float64(); value != test.value {
+			t.Errorf("%v: got %f, expected %f",
+				test.r, value, test.value)
+		}
+
+		if s := test.r.String(); s != test.string {
+			t.Errorf("got %q, expected %q", s, test.string)
+		}
+	}
+}
+
+func TestRationalRescale(t *testing.T) {
+	tests := []struct {
+		value    int64
+		from, to Rational
+		expected int64
+	}{
+		{1500, Rational{1, 1000}, Rational{1, 90000}, 135000},
+		{135000, Rational{1, 90000}, Rational{1, 1000}, 1500},
+		// The values are rounded to the nearest unit.
+		{44, Rational{1, 90000}, Rational{1, 1000}, 0},
+		{45, Rational{1, 90000}, Rational{1, 1000}, 1},
+		{-45, Rational{1, 90000}, Rational{1, 1000}, -1},
+		{1001, Rational{1001, 30000}, Rational{1, 30000}, 1002001},
+		{NoTimestamp, Rational{1, 1000}, Rational{1, 90000}, NoTimestamp},
+	}
+
+	for _, test := range tests {
+		rescaled := test.from.Rescale(test.value, test.to)
+
+		if rescaled != test.expected {
+			t.Errorf("%d from %v to %v: got %d, expected %d",
+				test.value, test.from, test.to,
+				rescaled, test.expected)
+		}
+	}
+}
+
+func TestRationalDuration(t *testing.T) {
+	tests := []struct {
+		r        Rational
+		ts       int64
+		duration time.Duration
+	}{
+		{Rational{1, 1000}, 1500, 1500 * time.Millisecond},
+		{Rational{1, 90000}, 90000, time.Second},
+		{Rational{1001, 30000}, 30, 1001 * time.Millisecond},
+		{Rational{1, 48000}, -48000, -time.Second},
+	}
+
+	for _, test := range tests {
+		duration, err := test.r.Duration(test.ts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if duration != test.duration {
+			t.Errorf("%d in %v: got %v, expected %v",
+				test.ts, test.r, duration, test.duration)
+		}
+
+		if ts := test.r.Timestamp(duration); ts != test.ts {
+			t.Errorf("%v in %v: got %d, expected %d",
+				duration, test.r, ts, test.ts)
+		}
+	}
+
+	_, err := Rational{1, 1000}.Duration(NoTimestamp)
+
+	if !errors.Is(err, ErrNoTimestamp) {
+		t.Fatalf("got %v, expected %v", err, ErrNoTimestamp)
+	}
+}
@@ -0,0 +1,321 @@
+package reisen
+
+// #cgo pkg-config: libavformat libavcodec libavutil
+// #include <stdint.h>
+// #include <libavcodec/avcodec.h>
+// #include <libavformat/avformat.h>
+// #include <libavutil/display.h>
+// #include <libavutil/imgutils.h>
+// #include <libavutil/pixdesc.h>
+//
+// // displayMatrix returns the display matrix
+// // of the stream or NULL if it has none.
+// static const int32_t *displayMatrix(AVStream *stream) {
+// #if LIBAVCODEC_VERSION_INT >= AV_VERSION_INT(60, 30, 100)
+// 	const AVPacketSideData *sideData = av_packet_side_data_get(
+// 		stream->codecpar->coded_side_data,
+// 		stream->codecpar->nb_coded_side_data,
+// 		AV_PKT_DATA_DISPLAYMATRIX);
+//
+// 	if (sideData == NULL || sideData->size < 9 * sizeof(int32_t)) {
+// 		return NULL;
+// 	}
+//
+// 	return (const int32_t *)sideData->data;
+// #else
+// 	size_t size = 0;
+// 	const uint8_t *data = av_stream_get_side_data(stream,
+// 		AV_PKT_DATA_DISPLAYMATRIX, &size);
+//
+// 	if (data == NULL || size < 9 * sizeof(int32_t)) {
+// 		return NULL;
+// 	}
+//
+// 	return (const int32_t *)data;
+// #endif
+// }
+import "C"
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"unsafe"
+)
+
+// TagRotate is the legacy metadata tag keeping the
+// clockwise rotation of the video stream (in degrees).
+const TagRotate = "rotate"
+
+// Rotation returns the clockwise angle (0, 90, 180
+// or 270 degrees) the frames of the stream should be
+// rotated by to be displayed upright. It's taken from
+// the display matrix of the stream or from the rotate
+// tag if there's no matrix.
+func (video *VideoStream) Rotation() int {
+	matrix := C.displayMatrix(video.inner)
+
+	if matrix != nil {
+		// libAV returns the
+		// counterclockwise angle.
+		angle := -float64(C.av_display_rotation_get(matrix))
+
+		if math.IsNaN(angle) {
+			return 0
+		}
+
+		return normalizeRotation(int(math.Round(angle)))
+	}
+
+	angle, err := strconv.Atoi(video.Metadata()[TagRotate])
+
+	if err != nil {
+		return 0
+	}
+
+	return normalizeRotation(angle)
+}
+
+// Mirrored returns 'true' if the display matrix
+// of the stream mirrors the frames horizontally
+// before rotating them.
+func (video *VideoStream) Mirrored() bool {
+	matrix := C.displayMatrix(video.inner)
+
+	if matrix == nil {
+		return false
+	}
+
+	m := unsafe.Slice(matrix, 9)
+
+	return int64(m[0])*int64(m[4])-int64(m[1])*int64(m[3]) < 0
+}
+
+// normalizeRotation rounds the angle to the
+// closest quarter turn in the 0-270 range.
+func normalizeRotation(angle int) int {
+	angle %= 360
+
+	if angle < 0 {
+		angle += 360
+	}
+
+	return (angle + 45) / 90 % 4 * 90
+}
+
+// rotateImage mirrors the image stored in the
+// contiguous buffer if needed and then rotates
+// it clockwise by the angle. It returns the new
+// buffer and the size of the rotated image.
+func rotateImage(format C.enum_AVPixelFormat, width, height int, data []byte, angle int, mirror bool) ([]byte, int, int, error) {
+	if angle == 0 && !mirror {
+		return data, width, height, nil
+	}
+
+	err := checkRotation(format, angle, mirror)
+
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	desc := C.av_pix_fmt_desc_get(format)
+	quarter := angle == 90 || angle == 270
+
+	var linesizes [4]C.int
+
+	status := C.av_image_fill_linesizes(
+		&linesizes[0], format, C.int(width))
+
+	if status < 0 {
+		return nil, 0, 0, newAVError(status,
+			"couldn't get the line sizes of the image")
+	}
+
+	rotated := make([]byte, len(data))
+	planes := int(C.av_pix_fmt_count_planes(format))
+	offset := 0
+
+	for p := 0; p < planes; p++ {
+		planeWidth, planeHeight := width, height
+
+		// The planes 1 and 2 of the YUV
+		// formats are the chroma ones.
+		if p == 1 || p == 2 {
+			planeWidth = ceilShift(width, int(desc.log2_chroma_w))
+			planeHeight = ceilShift(height, int(desc.log2_chroma_h))
+		}
+
+		lineSize := int(linesizes[p])
+
+		if planeWidth == 0 || lineSize%planeWidth != 0 {
+			return nil, 0, 0, ErrorInvalidValue.wrap(fmt.Sprintf(
+				"couldn't rotate the image of the pixel format %s",
+				pixelFormatName(format)))
+		}
+
+		size := lineSize * planeHeight
+		rotatePlane(rotated[offset:offset+size], data[offset:offset+size],
+			planeWidth, planeHeight, lineSize/planeWidth, angle, mirror)
+		offset += size
+	}
+
+	if quarter {
+		width, height = height, width
+	}
+
+	return rotated, width, height, nil
+}
+
+// checkRotation reports an error if the images
+// of the pixel format can't be mirrored and
+// rotated by the angle.
+func checkRotation(format C.enum_AVPixelFormat, angle int, mirror bool) error {
+	if angle == 0 && !mirror {
+		return nil
+	}
+
+	desc := C.av_pix_fmt_desc_get(format)
+
+	if desc == nil || desc.flags&(C.AV_PIX_FMT_FLAG_BITSTREAM|
+		C.AV_PIX_FMT_FLAG_HWACCEL) != 0 {
+		return ErrorInvalidValue.wrap(fmt.Sprintf(
+			"couldn't rotate the image of the pixel format %s",
+			pixelFormatName(format)))
+	}
+
+	// The chroma samples of the packed
+	// formats (e.g. yuyv422) are shared
+	// by neighbouring pixels, so they
+	// can't be moved pixel by pixel.
+	if desc.log2_chroma_w != 0 &&
+		C.av_pix_fmt_count_planes(format) == 1 {
+		return ErrorInvalidValue.wrap(fmt.Sprintf(
+			"couldn't rotate the image of the pixel format %s",
+			pixelFormatName(format)))
+	}
+
+	// The chroma subsampling of the
+	// rotated image must stay the same.
+	if (angle == 90 || angle == 270) &&
+		desc.log2_chroma_w != desc.log2_chroma_h {
+		return ErrorInvalidValue.wrap(fmt.Sprintf(
+			"couldn't rotate the image of the pixel format %s by %d degrees",
+			pixelFormatName(format), angle))
+	}
+
+	return nil
+}
+
+// pixel is a pixel of a plane
+// of the supported size.
+type pixel interface {
+	[1]byte | [2]byte | [3]byte | [4]byte | [6]byte | [8]byte
+}
+
+// rotatePlane mirrors the plane of pixels if
+// needed and then rotates it clockwise by the
+// angle writing the result to the destination.
+func rotatePlane(dst, src []byte, width, height, pixelSize, angle int, mirror bool) {
+	switch pixelSize {
+	case 1:
+		rotatePixels(pixels[[1]byte](dst), pixels[[1]byte](src),
+			width, height, angle, mirror)
+
+	case 2:
+		rotatePixels(pixels[[2]byte](dst), pixels[[2]byte](src),
+			width, height, angle, mirror)
+
+	case 3:
+		rotatePixels(pixels[[3]byte](dst), pixels[[3]byte](src),
+			width, height, angle, mirror)
+
+	case 4:
+		rotatePixels(pixels[[4]byte](dst), pixels[[4]byte](src),
+			width, height, angle, mirror)
+
+	case 6:
+		rotatePixels(pixels[[6]byte](dst), pixels[[6]byte](src),
+			width, height, angle, mirror)
+
+	case 8:
+		rotatePixels(pixels[[8]byte](dst), pixels[[8]byte](src),
+			width, height, angle, mirror)
+
+	default:
+		// The pixels of the other sizes
+		// are copied byte by byte.
+		for y := 0; y < height; y++ {
+			start, step := rotatedRow(width, height, y, angle, mirror)
+
+			for x := 0; x < width; x++ {
+				srcOffset := (y*width + x) * pixelSize
+				dstOffset := (start + x*step) * pixelSize
+				copy(dst[dstOffset:dstOffset+pixelSize],
+					src[srcOffset:srcOffset+pixelSize])
+			}
+		}
+	}
+}
+
+// rotatePixels mirrors and rotates the
+// plane row by row. The pixels of a row
+// land at a constant step from each other.
+func rotatePixels[T pixel](dst, src []T, width, height, angle int, mirror bool) {
+	for y := 0; y < height; y++ {
+		row := src[y*width : (y+1)*width]
+		start, step := rotatedRow(width, height, y, angle, mirror)
+
+		for x, value := range row {
+			dst[start+x*step] = value
+		}
+	}
+}
+
+// rotatedRow returns the index of the first pixel
+// of the source row in the rotated plane and the
+// step between the indices of its pixels.
+func rotatedRow(width, height, y, angle int, mirror bool) (int, int) {
+	var start, step int
+
+	switch angle {
+	case 90:
+		start, step = height-1-y, height
+
+	case 180:
+		start, step = (height-1-y)*width+width-1, -1
+
+	case 270:
+		start, step = (width-1)*height+y, -height
+
+	default:
+		start, step = y*width, 1
+	}
+
+	// The mirrored row is
+	// written backwards.
+	if mirror {
+		start += step * (width - 1)
+		step = -step
+	}
+
+	return start, step
+}
+
+// pixels reinterprets the buffer
+// as a slice of the pixels.
+func pixels[T pixel](data []byte) []T {
+	var value T
+
+	size := int(unsafe.Sizeof(value))
+
+	if len(data) < size {
+		return nil
+	}
+
+	return unsafe.Slice((*T)(unsafe.Pointer(&data[0])), len(data)/size)
+}
+
+// ceilShift divides the value by 2^shift
+// rounding the result up.
+func ceilShift(value, shift int) int {
+	return (value + (1 << shift) - 1) >> shift
+}
@@ -0,0 +1,102 @@
+package reisen
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// rotatedIndex returns the index of the pixel
+// in the mirrored and then rotated plane.
+func rotatedIndex(width, height, x, y, angle int, mirror bool) int {
+	if mirror {
+		x = width - 1 - x
+	}
+
+	switch angle {
+	case 90:
+		return x*height + height - 1 - y
+
+	case 180:
+		return (height-1-y)*width + width - 1 - x
+
+	case 270:
+		return (width-1-x)*height + y
+
+	default:
+		return y*width + x
+	}
+}
+
+func TestRotatedRow(t *testing.T) {
+	tests := []struct {
+		angle  int
+		mirror bool
+		start  int
+		step   int
+	}{
+		// The second row of a 3x2 plane.
+		{0, false, 3, 1},
+		{90, false, 0, 2},
+		{180, false, 2, -1},
+		{270, false, 5, -2},
+		{0, true, 5, -1},
+		{90, true, 4, -2},
+		{180, true, 0, 1},
+		{270, true, 1, 2},
+	}
+
+	for _, test := range tests {
+		start, step := rotatedRow(3, 2, 1,
+			test.angle, test.mirror)
+
+		if start != test.start || step != test.step {
+			t.Errorf("%d degrees, mirrored %t: got (%d, %d), expected (%d, %d)",
+				test.angle, test.mirror, start, step,
+				test.start, test.step)
+		}
+	}
+}
+
+func TestRotatePlane(t *testing.T) {
+	sizes := [][2]int{{1, 1}, {3, 2}, {2, 5}, {4, 4}}
+
+	for _, pixelSize := range []int{1, 2, 3, 4, 5, 6, 8} {
+		for _, size := range sizes {
+			for _, angle := range []int{0, 90, 180, 270} {
+				for _, mirror := range []bool{false, true} {
+					width, height := size[0], size[1]
+					name := fmt.Sprintf("%d bytes %dx%d %d degrees mirrored %t",
+						pixelSize, width, height, angle, mirror)
+
+					t.Run(name, func(t *testing.T) {
+						src := make([]byte, width*height*pixelSize)
+
+						for i := range src {
+							src[i] = byte(i)
+						}
+
+						expected := make([]byte, len(src))
+
+						for y := 0; y < height; y++ {
+							for x := 0; x < width; x++ {
+								i := rotatedIndex(width, height,
+									x, y, angle, mirror)
+								copy(expected[i*pixelSize:(i+1)*pixelSize],
+									src[(y*width+x)*pixelSize:])
+							}
+						}
+
+						dst := make([]byte, len(src))
+						rotatePlane(dst, src, width, height,
+							pixelSize, angle, mirror)
+
+						if !bytes.Equal(dst, expected) {
+							t.Fatalf("got %v, expected %v", dst, expected)
+						}
+					})
+				}
+			}
+		}
+	}
+}
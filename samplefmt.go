@@ -0,0 +1,157 @@
+package reisen
+
+// #cgo pkg-config: libavutil
+// #include <libavutil/channel_layout.h>
+// #include <libavutil/samplefmt.h>
+import "C"
+import "math/bits"
+
+// SampleFormat is a sample format
+// of the decoded audio frames.
+type SampleFormat int
+
+const (
+	// SampleFormatF64 is a 64-bit
+	// floating point format (float64).
+	SampleFormatF64 SampleFormat = iota
+	// SampleFormatF32 is a 32-bit
+	// floating point format (float32).
+	SampleFormatF32
+	// SampleFormatS16 is a signed
+	// 16-bit integer format (int16).
+	SampleFormatS16
+	// SampleFormatS32 is a signed
+	// 32-bit integer format (int32).
+	SampleFormatS32
+)
+
+// String returns the name of the sample format.
+func (format SampleFormat) String() string {
+	switch format {
+	case SampleFormatF64:
+		return "f64"
+
+	case SampleFormatF32:
+		return "f32"
+
+	case SampleFormatS16:
+		return "s16"
+
+	case SampleFormatS32:
+		return "s32"
+
+	default:
+		return ""
+	}
+}
+
+// Size returns the size of
+// one sample (in bytes).
+func (format SampleFormat) Size() int {
+	switch format {
+	case SampleFormatF64:
+		return 8
+
+	case SampleFormatF32, SampleFormatS32:
+		return 4
+
+	case SampleFormatS16:
+		return 2
+
+	default:
+		return 0
+	}
+}
+
+// av returns the libAV sample format
+// or AV_SAMPLE_FMT_NONE if it's unknown.
+func (format SampleFormat) av(planar bool) C.enum_AVSampleFormat {
+	var avFormat C.enum_AVSampleFormat
+
+	switch format {
+	case SampleFormatF64:
+		avFormat = C.AV_SAMPLE_FMT_DBL
+
+	case SampleFormatF32:
+		avFormat = C.AV_SAMPLE_FMT_FLT
+
+	case SampleFormatS16:
+		avFormat = C.AV_SAMPLE_FMT_S16
+
+	case SampleFormatS32:
+		avFormat = C.AV_SAMPLE_FMT_S32
+
+	default:
+		return C.AV_SAMPLE_FMT_NONE
+	}
+
+	if planar {
+		return C.av_get_planar_sample_fmt(avFormat)
+	}
+
+	return avFormat
+}
+
+// ChannelLayout is a set of channels
+// of the decoded audio frames.
+type ChannelLayout uint64
+
+const (
+	// ChannelLayoutMono is a
+	// single channel layout.
+	ChannelLayoutMono ChannelLayout = C.AV_CH_FRONT_CENTER
+	// ChannelLayoutStereo is a left
+	// and right channel layout.
+	ChannelLayoutStereo ChannelLayout = C.AV_CH_FRONT_LEFT |
+		C.AV_CH_FRONT_RIGHT
+	// ChannelLayout5Point1 is a 5.1
+	// surround channel layout.
+	ChannelLayout5Point1 ChannelLayout = ChannelLayoutStereo |
+		C.AV_CH_FRONT_CENTER | C.AV_CH_LOW_FREQUENCY |
+		C.AV_CH_SIDE_LEFT | C.AV_CH_SIDE_RIGHT
+	// ChannelLayoutNative keeps all the channels
+	// of the source in their order, including the
+	// layouts that can't be described with a set
+	// of speakers (e.g. ambisonic).
+	ChannelLayoutNative ChannelLayout = 1 << 63
+)
+
+// ChannelCount returns the number of channels
+// or 0 for the native layout, where it depends
+// on the source.
+func (layout ChannelLayout) ChannelCount() int {
+	if layout == ChannelLayoutNative {
+		return 0
+	}
+
+	return bits.OnesCount64(uint64(layout))
+}
+
+// describeChannels returns the description
+// of the channel layout (e.g. "5.1(side)" or
+// "ambisonic 1") and the names of its channels.
+func describeChannels(layout *C.AVChannelLayout) (string, []string) {
+	buffer := make([]C.char, 256)
+	status := C.av_channel_layout_describe(layout,
+		&buffer[0], C.size_t(len(buffer)))
+	description := ""
+
+	if status >= 0 {
+		description = C.GoString(&buffer[0])
+	}
+
+	names := make([]string, layout.nb_channels)
+
+	for i := range names {
+		channel := C.av_channel_layout_channel_from_index(
+			layout, C.uint(i))
+		status = C.av_channel_name(&buffer[0],
+			C.size_t(len(buffer)), channel)
+
+		if status >= 0 {
+			names[i] = C.GoString(&buffer[0])
+		}
+	}
+
+	return description, names
+}
@@ -0,0 +1,193 @@
+package reisen
+
+// #cgo pkg-config: libavformat libavcodec libavutil
+// #include <libavcodec/avcodec.h>
+// #include <libavformat/avformat.h>
+import "C"
+import (
+	"math"
+	"time"
+)
+
+// SeekMode defines how precisely
+// the media is sought.
+type SeekMode int
+
+const (
+	// SeekKeyframe moves the media to the closest
+	// keyframe at or before the requested time.
+	SeekKeyframe SeekMode = iota
+	// SeekAccurate moves the media to the closest
+	// keyframe before the requested time and then
+	// decodes forward discarding the frames until
+	// the requested time is reached.
+	SeekAccurate
+)
+
+// String returns the string
+// representation of the seek mode.
+func (mode SeekMode) String() string {
+	switch mode {
+	case SeekKeyframe:
+		return "keyframe"
+
+	case SeekAccurate:
+		return "accurate"
+
+	default:
+		return ""
+	}
+}
+
+// Seek moves all the streams of the media to the
+// specified time and returns the position actually
+// reached, i.e. the presentation offset of the next
+// frame of the opened video stream (or the opened
+// audio stream if there's no video one).
+//
+// The decoders of the opened streams are flushed, so
+// no data read before seeking is returned afterwards.
+// If the media is not opened for decoding, only the
+// demuxer is moved and the requested time is returned.
+//
+// After seeking, the streams read the packets on their
+// own again even if ReadPacket has been used before.
+func (media *Media) Seek(t time.Duration, mode SeekMode) (time.Duration, error) {
+	ts := durationToTimestamp(t, globalTimeBase())
+	status := C.avformat_seek_file(media.ctx, -1,
+		math.MinInt64, ts, ts, 0)
+
+	if status < 0 {
+		return 0, newAVError(status,
+			"couldn't seek the media")
+	}
+
+	media.releasePacket()
+	media.discardFiltered()
+	media.manual = false
+
+	for _, stream := range media.streams {
+		stream.reset()
+	}
+
+	if media.packet == nil {
+		return t, nil
+	}
+
+	return media.decodeUntil(t, mode)
+}
+
+// decodeUntil reads the packets after seeking
+// until every opened stream has a frame at the
+// requested time. In the accurate mode all the
+// earlier frames are discarded.
+func (media *Media) decodeUntil(t time.Duration, mode SeekMode) (time.Duration, error) {
+	var reference *baseStream
+
+	waiting := map[int]*baseStream{}
+
+	for _, stream := range media.streams {
+		decoder := decoderOf(stream)
+
+		if decoder == nil {
+			continue
+		}
+
+		if reference == nil || (reference.Type() != StreamVideo &&
+			decoder.Type() == StreamVideo) {
+			reference = decoder
+		}
+
+		waiting[decoder.Index()] = decoder
+	}
+
+	for len(waiting) > 0 {
+		ok, err := media.readPacket()
+
+		if err != nil {
+			return 0, err
+		}
+
+		if !ok {
+			break
+		}
+
+		if !media.pending {
+			continue
+		}
+
+		index := int(media.packet.stream_index)
+		packet := media.pendingPacket(index)
+		stream := media.streams[index]
+		target := durationToTimestamp(t,
+			stream.innerStream().time_base)
+
+		switch s := stream.(type) {
+		case *DataStream:
+			if s.isOpened && (mode == SeekKeyframe ||
+				packet.pts == noTimestamp || packet.pts >= target) {
+				err = media.park(index, false)
+
+				if err != nil {
+					return 0, err
+				}
+			}
+
+		default:
+			decoder := decoderOf(stream)
+
+			if decoder == nil {
+				break
+			}
+
+			err = decoder.decode(packet)
+
+			if err != nil {
+				media.releasePacket()
+				return 0, err
+			}
+
+			if mode == SeekAccurate {
+				decoder.discardFramesBefore(target)
+			}
+
+			if len(decoder.frames) > 0 {
+				delete(waiting, index)
+			}
+		}
+
+		media.releasePacket()
+	}
+
+	if reference == nil || len(reference.frames) == 0 ||
+		reference.frames[0].pts == noTimestamp {
+		return t, nil
+	}
+
+	return timestampToDuration(reference.frames[0].pts,
+		reference.inner.time_base), nil
+}
+
+// decoderOf returns the base of the stream
+// if it's opened for decoding with libAV,
+// and nil otherwise.
+func decoderOf(stream Stream) *baseStream {
+	var base *baseStream
+
+	switch s := stream.(type) {
+	case *VideoStream:
+		base = &s.baseStream
+
+	case *AudioStream:
+		base = &s.baseStream
+
+	default:
+		return nil
+	}
+
+	if !base.opened {
+		return nil
+	}
+
+	return base
+}
@@ -1,10 +1,24 @@
 package reisen
 
 // #cgo pkg-config: libavutil libavformat libavcodec
+// #include <stdlib.h>
 // #include <libavcodec/avcodec.h>
 // #include <libavformat/avformat.h>
 // #include <libavutil/avconfig.h>
 // #include <libavcodec/bsf.h>
+//
+// // The picture numbers of the frames
+// // were removed in FFmpeg 7.0, so -1
+// // is returned there.
+// static void pictureNumbers(const AVFrame *frame, int *coded, int *display) {
+// #if LIBAVUTIL_VERSION_MAJOR < 59
+// 	*coded = frame->coded_picture_number;
+// 	*display = frame->display_picture_number;
+// #else
+// 	*coded = -1;
+// 	*display = -1;
+// #endif
+// }
 import "C"
 import (
 	"fmt"
@@ -54,20 +68,24 @@ type Stream interface {
 
 	// filter returns the filter context of the stream.
 	filter() *C.AVBSFContext
-	// filterIn returns the input
-	// packet for the stream filter.
-	filterIn() *C.AVPacket
-	// filterOut returns the output
-	// packet for the stream filter.
-	filterOut() *C.AVPacket
-
-	// open opens the stream for decoding.
-	open() error
+
+	// open opens the stream for decoding
+	// with the specified decoder options.
+	open(Options) error
 	// read decodes the packet and obtains a
 	// frame from it.
 	read() (bool, error)
 	// close closes the stream for decoding.
 	close() error
+	// reset drops all the data buffered
+	// for decoding after seeking.
+	reset()
+	// enqueue parks the packet
+	// for decoding it later.
+	enqueue(*C.AVPacket)
+	// setFeed makes the stream receive
+	// the packets from the channel.
+	setFeed(<-chan *C.AVPacket)
 
 	// Index returns the index
 	// number of the stream.
@@ -95,14 +113,27 @@ type Stream interface {
 	// time duration in time base units
 	// of the stream.
 	TimeBase() (int, int)
+	// TimeBaseRational returns the time
+	// base of the stream as a rational.
+	TimeBaseRational() Rational
 	// FrameRate returns the approximate
 	// frame rate (FPS) of the stream.
 	FrameRate() (int, int)
 	// FrameCount returns the total number
 	// of frames in the stream.
 	FrameCount() int64
+	// Metadata returns the metadata
+	// tags of the stream.
+	Metadata() map[string]string
+	// TimestampReport returns the irregularities
+	// of the timestamps of the frames read from
+	// the stream so far.
+	TimestampReport() TimestampReport
 	// Open opens the stream for decoding.
 	Open() error
+	// Opened returns 'true' if the stream
+	// is opened for decoding.
+	Opened() bool
 	// Rewind rewinds the whole media to the
 	// specified time location based on the stream.
 	Rewind(time.Duration) error
@@ -117,7 +148,24 @@ type Stream interface {
 	// filter from the stream and frees its memory.
 	RemoveFilter() error
 	// ReadFrame decodes the next frame from the stream.
+	//
+	// A packet can produce several frames. The frames
+	// not returned yet are kept in the queue of the
+	// stream and served by the subsequent calls.
+	//
+	// If the packets are dispatched with ReadPacket,
+	// no frame is reported when the queue is empty.
+	// Otherwise the stream reads the packets on its
+	// own, parking the packets of the other opened
+	// streams for them, and reports no more data at
+	// the end of the media. If the parked packets
+	// exceed the limit, ErrPacketQueueFull is returned
+	// and the other streams should be read first.
 	ReadFrame() (Frame, bool, error)
+	// Flush drains the decoder of the stream
+	// and returns the frames left in it after
+	// the end of the media has been reached.
+	Flush() ([]Frame, error)
 	// Closes the stream for decoding.
 	Close() error
 }
@@ -125,18 +173,25 @@ type Stream interface {
 // baseStream holds the information
 // common for all media data streams.
 type baseStream struct {
-	media           *Media
-	inner           *C.AVStream
-	codecParams     *C.AVCodecParameters
-	codec           *C.AVCodec
-	codecCtx        *C.AVCodecContext
-	frame           *C.AVFrame
-	filterArgs      string
-	filterCtx       *C.AVBSFContext
-	filterInPacket  *C.AVPacket
-	filterOutPacket *C.AVPacket
-	skip            bool
-	opened          bool
+	media       *Media
+	inner       *C.AVStream
+	codecParams *C.AVCodecParameters
+	codec       *C.AVCodec
+	codecCtx    *C.AVCodecContext
+	frame       *C.AVFrame
+	frames      []*C.AVFrame
+	packets     []*C.AVPacket
+	feed        <-chan *C.AVPacket
+	options     Options
+	filterArgs  string
+	filterCtx   *C.AVBSFContext
+	graph       *filterGraph
+	frameIndex  int
+	skip        bool
+	draining    bool
+	opened      bool
+	guard       *leakGuard
+	timestamps  timestampTracker
 }
 
 // Opened returns 'true' if the stream
@@ -181,18 +236,12 @@ func (stream *baseStream) BitRate() int64 {
 }
 
 // Duration returns the duration of the stream.
+//
+// ErrNoTimestamp is returned if
+// the duration is unknown.
 func (stream *baseStream) Duration() (time.Duration, error) {
-	dur := stream.inner.duration
-
-	if dur < 0 {
-		dur = 0
-	}
-
-	tmNum, tmDen := stream.TimeBase()
-	factor := float64(tmNum) / float64(tmDen)
-	tm := float64(dur) * factor
-
-	return time.ParseDuration(fmt.Sprintf("%fs", tm))
+	return stream.TimeBaseRational().
+		Duration(int64(stream.inner.duration))
 }
 
 // TimeBase the numerator and the denominator of the
@@ -206,6 +255,12 @@ func (stream *baseStream) TimeBase() (int, int) {
 		int(stream.inner.time_base.den)
 }
 
+// TimeBaseRational returns the time
+// base of the stream as a rational.
+func (stream *baseStream) TimeBaseRational() Rational {
+	return newRational(stream.inner.time_base)
+}
+
 // FrameRate returns the frame rate of the stream
 // as a fraction with a numerator and a denominator.
 func (stream *baseStream) FrameRate() (int, int) {
@@ -219,58 +274,86 @@ func (stream *baseStream) FrameCount() int64 {
 	return int64(stream.inner.nb_frames)
 }
 
+// Metadata returns the metadata
+// tags of the stream.
+func (stream *baseStream) Metadata() map[string]string {
+	return dictionaryEntries(stream.inner.metadata)
+}
+
+// CreationTime returns the time the stream
+// was created at according to its metadata.
+func (stream *baseStream) CreationTime() (time.Time, bool) {
+	return creationTime(stream.Metadata())
+}
+
+// HandlerName returns the name of the stream
+// handler (e.g. "GoPro AVC") or "" if it's
+// unknown.
+func (stream *baseStream) HandlerName() string {
+	return stream.Metadata()[TagHandlerName]
+}
+
+// Language returns the language
+// code of the stream or "" if
+// it's unknown.
+func (stream *baseStream) Language() string {
+	return stream.Metadata()[TagLanguage]
+}
+
 // ApplyFilter applies a filter defined
 // by the given string to the stream.
+//
+// The filter replaces the one applied
+// before. If the stream is opened, its
+// decoder is reopened with the codec
+// parameters produced by the filter.
 func (stream *baseStream) ApplyFilter(args string) error {
-	status := C.av_bsf_list_parse_str(
-		C.CString(args), &stream.filterCtx)
+	var filterCtx *C.AVBSFContext
 
-	if status < 0 {
-		return fmt.Errorf(
-			"%d: couldn't create a filter context", status)
-	}
-
-	status = C.avcodec_parameters_copy(stream.filterCtx.par_in, stream.codecParams)
+	cArgs := C.CString(args)
+	status := C.av_bsf_list_parse_str(cArgs, &filterCtx)
+	C.free(unsafe.Pointer(cArgs))
 
 	if status < 0 {
-		return fmt.Errorf(
-			"%d: couldn't copy the input codec parameters to the filter", status)
+		return newAVError(status,
+			"couldn't create a filter context")
 	}
 
-	status = C.avcodec_parameters_copy(stream.filterCtx.par_out, stream.codecParams)
+	status = C.avcodec_parameters_copy(filterCtx.par_in, stream.codecParams)
 
 	if status < 0 {
-		return fmt.Errorf(
-			"%d: couldn't copy the output codec parameters to the filter", status)
-	}
+		C.av_bsf_free(&filterCtx)
 
-	stream.filterCtx.time_base_in = stream.inner.time_base
-	stream.filterCtx.time_base_out = stream.inner.time_base
+		return newAVError(status,
+			"couldn't copy the input codec parameters to the filter")
+	}
 
-	status = C.av_bsf_init(stream.filterCtx)
+	// The output parameters and the output
+	// time base are set by the filter.
+	filterCtx.time_base_in = stream.inner.time_base
+	status = C.av_bsf_init(filterCtx)
 
 	if status < 0 {
-		return fmt.Errorf(
-			"%d: couldn't initialize the filter context", status)
-	}
-
-	stream.filterInPacket = C.av_packet_alloc()
+		C.av_bsf_free(&filterCtx)
 
-	if stream.filterInPacket == nil {
-		return fmt.Errorf(
-			"couldn't allocate a packet for filtering in")
+		return newAVError(status,
+			"couldn't initialize the filter context")
 	}
 
-	stream.filterOutPacket = C.av_packet_alloc()
+	// The packets left in the old
+	// filter are still decoded.
+	err := stream.drainFilter()
 
-	if stream.filterInPacket == nil {
-		return fmt.Errorf(
-			"couldn't allocate a packet for filtering out")
+	if err != nil {
+		C.av_bsf_free(&filterCtx)
+		return err
 	}
 
+	stream.freeFilter()
+	stream.filterCtx = filterCtx
 	stream.filterArgs = args
 
-	return nil
+	return stream.reopenCodec()
 }
 
 // Filter returns the name and arguments
@@ -287,42 +370,33 @@ func (stream *baseStream) RemoveFilter() error {
 		return fmt.Errorf("no filter applied")
 	}
 
-	C.av_bsf_free(&stream.filterCtx)
-	stream.filterCtx = nil
+	err := stream.drainFilter()
 
-	C.av_free(unsafe.Pointer(stream.filterInPacket))
-	stream.filterInPacket = nil
-	C.av_free(unsafe.Pointer(stream.filterOutPacket))
-	stream.filterOutPacket = nil
+	if err != nil {
+		return err
+	}
 
-	return nil
+	stream.freeFilter()
+
+	return stream.reopenCodec()
+}
+
+// freeFilter frees the filter context.
+func (stream *baseStream) freeFilter() {
+	C.av_bsf_free(&stream.filterCtx)
+	stream.filterArgs = ""
 }
 
-// Rewind rewinds the stream to
-// the specified time position.
+// Rewind rewinds the whole media to
+// the closest keyframe before the
+// specified time position.
 //
-// Can be used on all the types
-// of streams. However, it's better
-// to use it on the video stream of
-// the media file if you don't want
-// the streams of the playback to
-// desynchronyze.
+// Use Media.Seek to land on the
+// exact position.
 func (stream *baseStream) Rewind(t time.Duration) error {
-	tmNum, tmDen := stream.TimeBase()
-	factor := float64(tmDen) / float64(tmNum)
-	seconds := t.Seconds()
-	dur := int64(seconds * factor)
-
-	status := C.av_seek_frame(stream.media.ctx,
-		stream.inner.index, rewindPosition(dur),
-		C.AVSEEK_FLAG_FRAME|C.AVSEEK_FLAG_BACKWARD)
-
-	if status < 0 {
-		return fmt.Errorf(
-			"%d: couldn't rewind the stream", status)
-	}
+	_, err := stream.media.Seek(t, SeekKeyframe)
 
-	return nil
+	return err
 }
 
 // innerStream returns the inner
@@ -336,130 +410,384 @@ func (stream *baseStream) filter() *C.AVBSFContext {
 	return stream.filterCtx
 }
 
-// filterIn returns the input
-// packet for the stream filter.
-func (stream *baseStream) filterIn() *C.AVPacket {
-	return stream.filterInPacket
-}
+// open opens the stream for decoding
+// with the specified decoder options.
+func (stream *baseStream) open(options Options) error {
+	codecCtx, err := stream.openCodec(options)
+
+	if err != nil {
+		return err
+	}
+
+	stream.codecCtx = codecCtx
+	stream.options = options
+	stream.frame = C.av_frame_alloc()
+
+	if stream.frame == nil {
+		C.avcodec_free_context(&stream.codecCtx)
+
+		return ErrorNoMemory.wrap(
+			"couldn't allocate a new frame")
+	}
+
+	stream.opened = true
+	stream.guard = newLeakGuard(fmt.Sprintf(
+		"the decoding of the stream %d", stream.Index()))
 
-// filterOut returns the output
-// packet for the stream filter.
-func (stream *baseStream) filterOut() *C.AVPacket {
-	return stream.filterOutPacket
+	return nil
 }
 
-// open opens the stream for decoding.
-func (stream *baseStream) open() error {
-	stream.codecCtx = C.avcodec_alloc_context3(stream.codec)
+// openCodec opens a new codec context for the
+// codec parameters of the stream (filtered if
+// there's a bitstream filter).
+func (stream *baseStream) openCodec(options Options) (*C.AVCodecContext, error) {
+	codecCtx := C.avcodec_alloc_context3(stream.codec)
 
-	if stream.codecCtx == nil {
-		return fmt.Errorf("couldn't open a codec context")
+	if codecCtx == nil {
+		return nil, ErrorNoMemory.wrap(
+			"couldn't open a codec context")
 	}
 
 	status := C.avcodec_parameters_to_context(
-		stream.codecCtx, stream.codecParams)
+		codecCtx, stream.decoderParams())
 
 	if status < 0 {
-		return fmt.Errorf(
-			"%d: couldn't send codec parameters to the context", status)
+		C.avcodec_free_context(&codecCtx)
+
+		return nil, newAVError(status,
+			"couldn't send codec parameters to the context")
 	}
 
-	status = C.avcodec_open2(stream.codecCtx, stream.codec, nil)
+	dict, err := options.dictionary()
+
+	if err != nil {
+		C.avcodec_free_context(&codecCtx)
+		return nil, err
+	}
+
+	status = C.avcodec_open2(codecCtx, stream.codec, &dict)
 
 	if status < 0 {
-		return fmt.Errorf(
-			"%d: couldn't open the codec context", status)
+		C.av_dict_free(&dict)
+		C.avcodec_free_context(&codecCtx)
+
+		return nil, newAVError(status,
+			"couldn't open the codec context")
 	}
 
-	stream.frame = C.av_frame_alloc()
+	err = checkConsumed(dict)
 
-	if stream.frame == nil {
-		return fmt.Errorf(
-			"couldn't allocate a new frame")
+	if err != nil {
+		C.avcodec_free_context(&codecCtx)
+		return nil, err
 	}
 
-	stream.opened = true
+	return codecCtx, nil
+}
+
+// reopenCodec replaces the codec context of the
+// opened stream with a new one for the current
+// codec parameters of the stream. The frames left
+// in the old one are kept in the queue.
+func (stream *baseStream) reopenCodec() error {
+	if !stream.opened {
+		return nil
+	}
+
+	codecCtx, err := stream.openCodec(stream.options)
+
+	if err != nil {
+		return err
+	}
+
+	if !stream.draining {
+		err = stream.decode(nil)
+
+		if err != nil {
+			C.avcodec_free_context(&codecCtx)
+			return err
+		}
+	}
+
+	C.avcodec_free_context(&stream.codecCtx)
+	stream.codecCtx = codecCtx
+	stream.draining = false
 
 	return nil
 }
 
-// read decodes the packet and obtains a
-// frame from it.
+// read obtains the next decoded frame of the
+// stream. The packet read by the media for the
+// stream is decoded first, and then the oldest
+// frame of the queue becomes the current one.
 func (stream *baseStream) read() (bool, error) {
-	readPacket := stream.media.packet
+	stream.skip = false
 
-	if stream.filterCtx != nil {
-		readPacket = stream.filterOutPacket
+	// The packet read by the caller is decoded
+	// after the ones parked earlier.
+	err := stream.parkPending()
+
+	if err != nil {
+		return false, err
+	}
+
+	for len(stream.frames) == 0 && !stream.draining {
+		packet, ok, err := stream.nextPacket()
+
+		if err != nil {
+			return false, err
+		}
+
+		// Obtain the frames left in the
+		// decoder at the end of the media.
+		if !ok {
+			err = stream.drain()
+
+			if err != nil {
+				return false, err
+			}
+
+			continue
+		}
+
+		if packet == nil {
+			break
+		}
+
+		err = stream.decode(packet)
+		C.av_packet_free(&packet)
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if len(stream.frames) == 0 {
+		// The decoder is depleted.
+		if stream.draining {
+			return false, nil
+		}
+
+		// The decoder needs more packets.
+		stream.skip = true
+
+		return true, nil
 	}
 
+	C.av_frame_free(&stream.frame)
+	stream.frame = stream.frames[0]
+	stream.frames[0] = nil
+	stream.frames = stream.frames[1:]
+	stream.frameIndex++
+
+	return true, nil
+}
+
+// pictureNumbers returns the indices of the
+// current frame in the bitstream order and in
+// the display order. If libAV doesn't report
+// them, both are the index of the frame among
+// the ones read from the stream.
+func (stream *baseStream) pictureNumbers() (int, int) {
+	var coded, display C.int
+
+	C.pictureNumbers(stream.frame, &coded, &display)
+
+	if coded < 0 || display < 0 {
+		return stream.frameIndex - 1, stream.frameIndex - 1
+	}
+
+	return int(coded), int(display)
+}
+
+// decode sends the packet to the decoder
+// and puts all the frames it produces to
+// the queue of the stream (through the
+// filter graph if there's one). A nil packet
+// signals the end of the stream.
+func (stream *baseStream) decode(packet *C.AVPacket) error {
 	status := C.avcodec_send_packet(
-		stream.codecCtx, readPacket)
+		stream.codecCtx, packet)
 
 	if status < 0 {
-		stream.skip = false
+		return newAVError(status,
+			"couldn't send the packet to the codec context")
+	}
+
+	for {
+		frame := C.av_frame_alloc()
+
+		if frame == nil {
+			return ErrorNoMemory.wrap(
+				"couldn't allocate a new frame")
+		}
+
+		status = C.avcodec_receive_frame(
+			stream.codecCtx, frame)
+
+		if status < 0 {
+			C.av_frame_free(&frame)
+
+			// All the frames decoded
+			// from the packet are received.
+			if status == C.int(ErrorAgain) ||
+				status == C.int(ErrorEndOfFile) {
+				return nil
+			}
+
+			return newAVError(status,
+				"couldn't receive the frame from the codec context")
+		}
+
+		err := stream.filterFrame(frame)
+
+		if err != nil {
+			return err
+		}
+	}
+}
 
-		return false, fmt.Errorf(
-			"%d: couldn't send the packet to the codec context", status)
+// discardFrames frees all the
+// frames queued in the stream.
+func (stream *baseStream) discardFrames() {
+	for i := range stream.frames {
+		C.av_frame_free(&stream.frames[i])
 	}
 
-	status = C.avcodec_receive_frame(
-		stream.codecCtx, stream.frame)
+	stream.frames = nil
+}
 
-	if status < 0 {
-		if status == C.int(ErrorAgain) {
-			stream.skip = true
-			return true, nil
+// discardFramesBefore drops the queued frames
+// ending before the specified timestamp.
+func (stream *baseStream) discardFramesBefore(ts C.int64_t) {
+	i := 0
+
+	for ; i < len(stream.frames); i++ {
+		frame := stream.frames[i]
+		end := frame.pts + frame.duration
+
+		if frame.duration <= 0 {
+			end = frame.pts + 1
 		}
 
-		stream.skip = false
+		if frame.pts == noTimestamp || end > ts {
+			break
+		}
 
-		return false, fmt.Errorf(
-			"%d: couldn't receive the frame from the codec context", status)
+		C.av_frame_free(&stream.frames[i])
 	}
 
-	C.av_packet_unref(stream.media.packet)
+	stream.frames = stream.frames[i:]
+}
+
+// reset drops all the data buffered
+// for decoding after seeking.
+func (stream *baseStream) reset() {
+	stream.discardPackets()
+	stream.timestamps.restart()
 
-	if stream.filterInPacket != nil {
-		C.av_packet_unref(stream.filterInPacket)
+	if stream.filterCtx != nil {
+		C.av_bsf_flush(stream.filterCtx)
 	}
 
-	if stream.filterOutPacket != nil {
-		C.av_packet_unref(stream.filterOutPacket)
+	if !stream.opened {
+		return
 	}
 
-	stream.skip = false
+	C.avcodec_flush_buffers(stream.codecCtx)
+	stream.discardFrames()
 
-	return true, nil
+	// The filter graph is built
+	// again for the next frame.
+	if stream.graph != nil {
+		stream.graph.free()
+	}
+
+	stream.draining = false
 }
 
-// close closes the stream for decoding.
-func (stream *baseStream) close() error {
-	C.av_free(unsafe.Pointer(stream.frame))
-	stream.frame = nil
+// drain switches the decoder of the stream
+// to the draining mode. All the frames
+// buffered inside the codec are moved to
+// the queue of the stream.
+func (stream *baseStream) drain() error {
+	if stream.draining {
+		return nil
+	}
 
-	status := C.avcodec_close(stream.codecCtx)
+	err := stream.decode(nil)
 
-	if status < 0 {
-		return fmt.Errorf(
-			"%d: couldn't close the codec", status)
+	if err != nil {
+		return err
 	}
 
-	if stream.filterCtx != nil {
-		C.av_bsf_free(&stream.filterCtx)
-		stream.filterCtx = nil
+	err = stream.flushFilterGraph()
+
+	if err != nil {
+		return err
 	}
 
-	if stream.filterInPacket != nil {
-		C.av_free(unsafe.Pointer(stream.filterInPacket))
-		stream.filterInPacket = nil
+	stream.draining = true
+
+	return nil
+}
+
+// flush drains the decoder of the stream
+// and collects all the remaining frames
+// with the read function.
+func (stream *baseStream) flush(read func() (Frame, bool, error)) ([]Frame, error) {
+	frames := []Frame{}
+
+	if !stream.opened {
+		return frames, nil
 	}
 
-	if stream.filterOutPacket != nil {
-		C.av_free(unsafe.Pointer(stream.filterOutPacket))
-		stream.filterOutPacket = nil
+	err := stream.drain()
+
+	if err != nil {
+		return frames, err
 	}
 
+	for {
+		frame, ok, err := read()
+
+		if err != nil {
+			return frames, err
+		}
+
+		if !ok {
+			break
+		}
+
+		if frame != nil {
+			frames = append(frames, frame)
+		}
+	}
+
+	return frames, nil
+}
+
+// close closes the stream for decoding
+// and removes its filters. It's safe to
+// call it several times.
+func (stream *baseStream) close() error {
+	stream.discardPackets()
+	stream.freeFilter()
+	stream.freeFilterGraph()
+
+	if !stream.opened {
+		return nil
+	}
+
+	C.av_frame_free(&stream.frame)
+	stream.discardFrames()
+	C.avcodec_free_context(&stream.codecCtx)
+	stream.guard.release()
+	stream.guard = nil
+
+	stream.draining = false
 	stream.opened = false
+	stream.frameIndex = 0
 
 	return nil
 }
@@ -0,0 +1,354 @@
+package reisen
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	fixtureSampleRate = 48000
+	fixtureChannels   = 2
+	// fixtureSamples is not a multiple of the
+	// frame size of the tests, so the last frame
+	// is only obtained when the stream is drained.
+	fixtureSamples = 10000
+	// splitFrameSize is the number of samples
+	// per frame the packets are split into.
+	splitFrameSize = 64
+)
+
+// writeFixture writes a WAV file of stereo 16-bit
+// PCM samples. The WAV demuxer puts about a thousand
+// samples into a packet.
+func writeFixture(t *testing.T) string {
+	t.Helper()
+
+	dataSize := fixtureSamples * fixtureChannels * 2
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, uint32(36 + dataSize),
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16),
+		uint16(1), uint16(fixtureChannels), uint32(fixtureSampleRate),
+		uint32(fixtureSampleRate * fixtureChannels * 2),
+		uint16(fixtureChannels * 2), uint16(16),
+		[4]byte{'d', 'a', 't', 'a'}, uint32(dataSize),
+	}
+
+	path := filepath.Join(t.TempDir(), "fixture.wav")
+	file, err := os.Create(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	for _, field := range header {
+		err = binary.Write(file, binary.LittleEndian, field)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	samples := make([]int16, fixtureSamples*fixtureChannels)
+
+	for i := range samples {
+		samples[i] = int16(i % 1000)
+	}
+
+	err = binary.Write(file, binary.LittleEndian, samples)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// openFixture opens the audio stream of the
+// fixture for decoding. The filter graph
+// splits every packet into several frames.
+func openFixture(t *testing.T, filterGraph string) (*Media, *AudioStream) {
+	t.Helper()
+
+	media, err := NewMedia(writeFixture(t))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(media.Close)
+	err = media.OpenDecode()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audio := media.AudioStreams()[0]
+
+	if filterGraph != "" {
+		err = audio.SetFilterGraph(filterGraph)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = audio.Open()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return media, audio
+}
+
+// fixtureFrameSize is the size (in bytes) of
+// one sample of the decoded stereo float64
+// frames of the fixture.
+const fixtureFrameSize = 2 * 8
+
+// requeueFrames decodes the specified number of
+// frames or all of them if it's negative and puts
+// them back to the front of the frame queue of the
+// stream, as if they were produced at once. It
+// returns their timestamps.
+func requeueFrames(t *testing.T, audio *AudioStream, count int) []int64 {
+	t.Helper()
+
+	frames := audio.frames[:0:0]
+	timestamps := []int64{}
+
+	for count < 0 || len(frames) < count {
+		ok, err := audio.read()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			break
+		}
+
+		frames = append(frames, audio.frame)
+		timestamps = append(timestamps, int64(audio.frame.pts))
+		audio.frame = nil
+	}
+
+	audio.frames = append(frames, audio.frames...)
+
+	return timestamps
+}
+
+// readTimestamps reads all the frames left in
+// the stream and returns their timestamps and
+// the total number of their samples.
+func readTimestamps(t *testing.T, audio *AudioStream) ([]int64, int) {
+	t.Helper()
+
+	timestamps := []int64{}
+	samples := 0
+
+	for {
+		frame, ok, err := audio.ReadAudioFrame()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			return timestamps, samples
+		}
+
+		if frame != nil {
+			timestamps = append(timestamps, frame.pts)
+			samples += len(frame.Data()) / fixtureFrameSize
+		}
+	}
+}
+
+func TestReadFrameServesQueuedFrames(t *testing.T) {
+	_, audio := openFixture(t, "")
+
+	// Queue the frames as if one
+	// packet has produced them all.
+	expected := requeueFrames(t, audio, 4)
+
+	if len(expected) != 4 {
+		t.Fatalf("got %d frames, expected 4", len(expected))
+	}
+
+	timestamps, samples := readTimestamps(t, audio)
+
+	if samples != fixtureSamples {
+		t.Fatalf("got %d samples, expected %d",
+			samples, fixtureSamples)
+	}
+
+	if !reflect.DeepEqual(timestamps[:4], expected) {
+		t.Fatalf("got the timestamps %v of the queued frames, expected %v",
+			timestamps[:4], expected)
+	}
+
+	for i := 1; i < len(timestamps); i++ {
+		if timestamps[i] <= timestamps[i-1] {
+			t.Fatalf("the frames are out of order: %v", timestamps)
+		}
+	}
+}
+
+func TestReadFrameServesFramesQueuedAtEnd(t *testing.T) {
+	_, audio := openFixture(t, "")
+
+	// Queue all the frames as if the
+	// decoder has produced them when
+	// it was drained.
+	expected := requeueFrames(t, audio, -1)
+
+	if !audio.draining {
+		t.Fatal("the decoder is not drained at the end of the media")
+	}
+
+	timestamps, samples := readTimestamps(t, audio)
+
+	if samples != fixtureSamples {
+		t.Fatalf("got %d samples, expected %d",
+			samples, fixtureSamples)
+	}
+
+	if !reflect.DeepEqual(timestamps, expected) {
+		t.Fatalf("got the timestamps %v, expected %v",
+			timestamps, expected)
+	}
+
+	rest, err := audio.Flush()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rest) > 0 {
+		t.Fatalf("got %d frames after the end", len(rest))
+	}
+}
+
+// checkFrames checks that all the samples of
+// the fixture have been decoded, padded to the
+// whole frames if they are split.
+func checkFrames(t *testing.T, filterGraph string, frames, samples int) {
+	t.Helper()
+
+	if filterGraph == "" {
+		if samples != fixtureSamples {
+			t.Fatalf("got %d samples, expected %d",
+				samples, fixtureSamples)
+		}
+
+		return
+	}
+
+	expected := (fixtureSamples + splitFrameSize - 1) / splitFrameSize
+
+	if frames != expected {
+		t.Fatalf("got %d frames, expected %d", frames, expected)
+	}
+
+	if samples != expected*splitFrameSize {
+		t.Fatalf("got %d samples, expected %d",
+			samples, expected*splitFrameSize)
+	}
+}
+
+var fixtureFilterGraphs = map[string]string{
+	"whole packets": "",
+	"split packets": "asetnsamples=n=64",
+}
+
+func TestReadFrameReturnsAllFrames(t *testing.T) {
+	for name, filterGraph := range fixtureFilterGraphs {
+		t.Run(name, func(t *testing.T) {
+			_, audio := openFixture(t, filterGraph)
+			frames, samples := 0, 0
+
+			for {
+				frame, ok, err := audio.ReadAudioFrame()
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !ok {
+					break
+				}
+
+				if frame == nil {
+					continue
+				}
+
+				frames++
+				samples += frame.SampleCount()
+			}
+
+			checkFrames(t, filterGraph, frames, samples)
+		})
+	}
+}
+
+func TestReadPacketThenFlushReturnsAllFrames(t *testing.T) {
+	for name, filterGraph := range fixtureFilterGraphs {
+		t.Run(name, func(t *testing.T) {
+			media, audio := openFixture(t, filterGraph)
+			frames, samples := 0, 0
+
+			for {
+				packet, ok, err := media.ReadPacket()
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !ok {
+					break
+				}
+
+				if packet == nil || packet.StreamIndex() != audio.Index() {
+					continue
+				}
+
+				// Drain the queue of the frames
+				// decoded from the packet.
+				for {
+					frame, ok, err := audio.ReadAudioFrame()
+
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if !ok || frame == nil {
+						break
+					}
+
+					frames++
+					samples += frame.SampleCount()
+				}
+			}
+
+			rest, err := audio.Flush()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, frame := range rest {
+				frames++
+				samples += frame.(*AudioFrame).SampleCount()
+			}
+
+			checkFrames(t, filterGraph, frames, samples)
+		})
+	}
+}
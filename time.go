@@ -3,9 +3,48 @@ package reisen
 // #cgo pkg-config: libavutil
 // #include <libavutil/avutil.h>
 import "C"
+import (
+	"errors"
+	"math"
+	"time"
+)
 
 const (
 	// TimeBase is a global time base
 	// used for describing media containers.
 	TimeBase int = C.AV_TIME_BASE
 )
+
+// noTimestamp is the value of
+// an unknown timestamp in libAV
+// (AV_NOPTS_VALUE).
+const noTimestamp = math.MinInt64
+
+// NoTimestamp is the value of the raw
+// timestamps and durations which are
+// unknown.
+const NoTimestamp int64 = noTimestamp
+
+// ErrNoTimestamp is returned when the time
+// is requested for an unknown timestamp.
+var ErrNoTimestamp = errors.New("no timestamp")
+
+// globalTimeBase returns the global
+// time base as a libAV rational.
+func globalTimeBase() C.AVRational {
+	return C.AVRational{num: 1, den: C.AV_TIME_BASE}
+}
+
+// timestampToDuration converts the timestamp
+// in the time base units to the time duration.
+func timestampToDuration(ts C.int64_t, timeBase C.AVRational) time.Duration {
+	return time.Duration(C.av_rescale_q(ts, timeBase,
+		C.AVRational{num: 1, den: C.int(time.Second)}))
+}
+
+// durationToTimestamp converts the time duration
+// to the timestamp in the time base units.
+func durationToTimestamp(t time.Duration, timeBase C.AVRational) C.int64_t {
+	return C.av_rescale_q(C.int64_t(t),
+		C.AVRational{num: 1, den: C.int(time.Second)}, timeBase)
+}
@@ -0,0 +1,242 @@
+package reisen
+
+// #cgo pkg-config: libavutil
+// #include <libavutil/frame.h>
+import "C"
+
+// TimestampGap is an interval between the
+// timestamps of two consecutive frames longer
+// than the duration of a frame, e.g. because
+// some frames were dropped.
+type TimestampGap struct {
+	// From is the timestamp of
+	// the frame before the gap.
+	From int64
+	// To is the timestamp of
+	// the frame after the gap.
+	To int64
+	// Missing is the estimated
+	// number of the missing frames.
+	Missing int
+}
+
+// TimestampJump is a timestamp of a frame
+// earlier than the one of the previous frame.
+type TimestampJump struct {
+	// From is the timestamp
+	// of the previous frame.
+	From int64
+	// To is the timestamp
+	// of the frame.
+	To int64
+}
+
+// TimestampSegment is a run of consecutive
+// frames following each other at the same
+// interval.
+type TimestampSegment struct {
+	// Start is the timestamp of
+	// the first frame of the segment.
+	Start int64
+	// Frames is the number of the
+	// intervals in the segment.
+	Frames int
+	// FrameDuration is the interval
+	// between the frames of the segment.
+	FrameDuration int64
+}
+
+// TimestampReport describes the irregularities of the
+// timestamps of the frames read from a stream. All the
+// timestamps are in the time base units of the stream.
+type TimestampReport struct {
+	// TimeBase is the time base
+	// of the timestamps.
+	TimeBase Rational
+	// Frames is the number
+	// of the checked frames.
+	Frames int
+	// Missing is the number of the
+	// frames without any timestamp.
+	Missing int
+	// Estimated is the number of the frames
+	// without a presentation timestamp which
+	// got the best effort one.
+	Estimated int
+	// Duplicates are the timestamps
+	// repeated by consecutive frames.
+	Duplicates []int64
+	// Gaps are the intervals
+	// with no frames.
+	Gaps []TimestampGap
+	// BackwardJumps are the timestamps
+	// going backwards.
+	BackwardJumps []TimestampJump
+	// Segments are the runs of frames with
+	// the same interval. More than one segment
+	// means the stream has a variable frame rate.
+	Segments []TimestampSegment
+}
+
+// DroppedFrames returns the estimated
+// number of frames missing in the gaps.
+func (report TimestampReport) DroppedFrames() int {
+	dropped := 0
+
+	for _, gap := range report.Gaps {
+		dropped += gap.Missing
+	}
+
+	return dropped
+}
+
+// VariableFrameRate returns 'true' if the
+// frames don't follow each other at the
+// same interval.
+func (report TimestampReport) VariableFrameRate() bool {
+	return len(report.Segments) > 1
+}
+
+// Regular returns 'true' if no
+// irregularities were found.
+func (report TimestampReport) Regular() bool {
+	return report.Missing == 0 &&
+		len(report.Duplicates) == 0 &&
+		len(report.Gaps) == 0 &&
+		len(report.BackwardJumps) == 0 &&
+		!report.VariableFrameRate()
+}
+
+// timestampTracker checks the timestamps
+// of the frames read from a stream.
+type timestampTracker struct {
+	report       TimestampReport
+	started      bool
+	last         int64
+	lastDuration int64
+}
+
+// track checks the timestamp of the next frame
+// against the one of the previous frame.
+func (tracker *timestampTracker) track(pts, duration int64, estimated bool) {
+	report := &tracker.report
+	report.Frames++
+
+	if estimated {
+		report.Estimated++
+	}
+
+	if pts == NoTimestamp {
+		report.Missing++
+		return
+	}
+
+	if !tracker.started {
+		tracker.started = true
+		tracker.last = pts
+		tracker.lastDuration = duration
+
+		return
+	}
+
+	delta := pts - tracker.last
+
+	switch {
+	case delta == 0:
+		report.Duplicates = append(report.Duplicates, pts)
+
+	case delta < 0:
+		report.BackwardJumps = append(report.BackwardJumps,
+			TimestampJump{From: tracker.last, To: pts})
+
+	default:
+		expected := tracker.lastDuration
+
+		if expected <= 0 && len(report.Segments) > 0 {
+			expected = report.Segments[len(report.
+				Segments)-1].FrameDuration
+		}
+
+		// The interval is considered a gap if it's
+		// longer than one and a half frames.
+		if expected > 0 && 2*delta > 3*expected {
+			report.Gaps = append(report.Gaps, TimestampGap{
+				From:    tracker.last,
+				To:      pts,
+				Missing: int((delta+expected/2)/expected) - 1,
+			})
+
+			break
+		}
+
+		tracker.extendSegment(delta)
+	}
+
+	tracker.last = pts
+	tracker.lastDuration = duration
+}
+
+// extendSegment adds the interval after the
+// previous frame to the current segment or
+// starts a new one if the interval differs.
+func (tracker *timestampTracker) extendSegment(delta int64) {
+	report := &tracker.report
+	n := len(report.Segments)
+
+	// The intervals differing by one unit
+	// are caused by rounding timestamps.
+	if n > 0 {
+		segment := &report.Segments[n-1]
+		diff := delta - segment.FrameDuration
+
+		if diff >= -1 && diff <= 1 {
+			segment.Frames++
+			return
+		}
+	}
+
+	report.Segments = append(report.Segments, TimestampSegment{
+		Start:         tracker.last,
+		Frames:        1,
+		FrameDuration: delta,
+	})
+}
+
+// restart makes the next frame not be compared
+// with the previous one, e.g. after seeking.
+func (tracker *timestampTracker) restart() {
+	tracker.started = false
+}
+
+// TimestampReport returns the irregularities of the
+// timestamps of the frames read from the stream so far.
+func (stream *baseStream) TimestampReport() TimestampReport {
+	report := stream.timestamps.report
+	report.TimeBase = stream.TimeBaseRational()
+	report.Duplicates = append([]int64(nil), report.Duplicates...)
+	report.Gaps = append([]TimestampGap(nil), report.Gaps...)
+	report.BackwardJumps = append([]TimestampJump(nil),
+		report.BackwardJumps...)
+	report.Segments = append([]TimestampSegment(nil),
+		report.Segments...)
+
+	return report
+}
+
+// frameTimestamp returns the presentation timestamp
+// of the current frame falling back to the best effort
+// one if it's unknown, and tracks the timestamp.
+func (stream *baseStream) frameTimestamp() int64 {
+	pts := int64(stream.frame.pts)
+	estimated := false
+
+	if pts == NoTimestamp {
+		pts = int64(stream.frame.best_effort_timestamp)
+		estimated = pts != NoTimestamp
+	}
+
+	stream.timestamps.track(pts,
+		int64(stream.frame.duration), estimated)
+
+	return pts
+}
@@ -0,0 +1,141 @@
+package reisen
+
+import (
+	"reflect"
+	"testing"
+)
+
+// trackedFrame is a frame
+// passed to the tracker.
+type trackedFrame struct {
+	pts       int64
+	duration  int64
+	estimated bool
+}
+
+func TestTimestampTrackerTrack(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []trackedFrame
+		report TimestampReport
+	}{
+		{
+			name:   "regular",
+			frames: []trackedFrame{{0, 10, false}, {10, 10, false}, {20, 10, false}, {30, 10, false}},
+			report: TimestampReport{
+				Frames:   4,
+				Segments: []TimestampSegment{{0, 3, 10}},
+			},
+		},
+		{
+			name:   "gap",
+			frames: []trackedFrame{{0, 10, false}, {10, 10, false}, {40, 10, false}, {50, 10, false}},
+			report: TimestampReport{
+				Frames:   4,
+				Gaps:     []TimestampGap{{10, 40, 2}},
+				Segments: []TimestampSegment{{0, 2, 10}},
+			},
+		},
+		{
+			name:   "no gap at one and a half frames",
+			frames: []trackedFrame{{0, 10, false}, {10, 10, false}, {25, 10, false}},
+			report: TimestampReport{
+				Frames:   3,
+				Segments: []TimestampSegment{{0, 1, 10}, {10, 1, 15}},
+			},
+		},
+		{
+			name:   "gap without frame durations",
+			frames: []trackedFrame{{0, 0, false}, {10, 0, false}, {40, 0, false}},
+			report: TimestampReport{
+				Frames:   3,
+				Gaps:     []TimestampGap{{10, 40, 2}},
+				Segments: []TimestampSegment{{0, 1, 10}},
+			},
+		},
+		{
+			name:   "duplicate",
+			frames: []trackedFrame{{0, 10, false}, {10, 10, false}, {10, 10, false}, {20, 10, false}},
+			report: TimestampReport{
+				Frames:     4,
+				Duplicates: []int64{10},
+				Segments:   []TimestampSegment{{0, 2, 10}},
+			},
+		},
+		{
+			name:   "backward jump",
+			frames: []trackedFrame{{0, 10, false}, {10, 10, false}, {5, 10, false}, {15, 10, false}},
+			report: TimestampReport{
+				Frames:        4,
+				BackwardJumps: []TimestampJump{{10, 5}},
+				Segments:      []TimestampSegment{{0, 2, 10}},
+			},
+		},
+		{
+			name: "variable frame rate",
+			frames: []trackedFrame{{0, 10, false}, {10, 10, false},
+				{20, 20, false}, {40, 20, false}, {60, 20, false}},
+			report: TimestampReport{
+				Frames:   5,
+				Segments: []TimestampSegment{{0, 2, 10}, {20, 2, 20}},
+			},
+		},
+		{
+			name:   "rounded intervals",
+			frames: []trackedFrame{{0, 33, false}, {33, 33, false}, {67, 33, false}, {100, 33, false}},
+			report: TimestampReport{
+				Frames:   4,
+				Segments: []TimestampSegment{{0, 3, 33}},
+			},
+		},
+		{
+			name:   "missing and estimated",
+			frames: []trackedFrame{{NoTimestamp, 10, false}, {0, 10, true}, {10, 10, false}},
+			report: TimestampReport{
+				Frames:    3,
+				Missing:   1,
+				Estimated: 1,
+				Segments:  []TimestampSegment{{0, 1, 10}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := timestampTracker{}
+
+			for _, frame := range test.frames {
+				tracker.track(frame.pts,
+					frame.duration, frame.estimated)
+			}
+
+			if !reflect.DeepEqual(tracker.report, test.report) {
+				t.Fatalf("got %+v, expected %+v",
+					tracker.report, test.report)
+			}
+		})
+	}
+}
+
+func TestTimestampReportSummary(t *testing.T) {
+	report := TimestampReport{
+		Gaps:     []TimestampGap{{10, 40, 2}, {50, 70, 1}},
+		Segments: []TimestampSegment{{0, 2, 10}, {20, 2, 20}},
+	}
+
+	if dropped := report.DroppedFrames(); dropped != 3 {
+		t.Fatalf("got %d dropped frames, expected 3", dropped)
+	}
+
+	if !report.VariableFrameRate() {
+		t.Fatal("the frame rate is not reported as variable")
+	}
+
+	if report.Regular() {
+		t.Fatal("the timestamps are reported as regular")
+	}
+
+	if !(TimestampReport{}).Regular() {
+		t.Fatal("the empty report is not regular")
+	}
+}
@@ -5,23 +5,83 @@ package reisen
 // #include <libavformat/avformat.h>
 // #include <libavutil/avutil.h>
 // #include <libavutil/imgutils.h>
+// #include <libavutil/pixdesc.h>
 // #include <libswscale/swscale.h>
 // #include <inttypes.h>
 import "C"
 import (
-	"fmt"
+	"image"
 	"unsafe"
 )
 
+// VideoFormat describes the format the
+// decoded video frames are converted to.
+type VideoFormat struct {
+	// Width is the width of the frames.
+	// If it's 0, the width of the stream
+	// is used.
+	Width int
+	// Height is the height of the frames.
+	// If it's 0, the height of the stream
+	// is used.
+	Height int
+	// Interpolation is the algorithm used for
+	// scaling. If it's 0, the bicubic one is
+	// used.
+	Interpolation InterpolationAlgorithm
+	// PixelFormat is the pixel format
+	// of the frames.
+	//
+	// The stream untagged with a color space
+	// is converted as BT.709 if it's at least
+	// 720 pixels tall and as BT.601 otherwise.
+	// SetColorSpace overrides the guess.
+	PixelFormat PixelFormat
+	// ColorRange is the color range of the RGB
+	// frames, full range if it's unspecified.
+	// The YUV frames keep the range of the
+	// stream.
+	ColorRange ColorRange
+	// Crop is the rectangle of the decoded
+	// frames (before rotating them) the
+	// output frames are produced from in
+	// the same scaling pass. If it's empty,
+	// the whole frames are used.
+	Crop image.Rectangle
+	// CorrectAspectRatio makes the frames be
+	// scaled to square pixels according to
+	// the sample aspect ratio reported by
+	// AspectRatio() if the size of the
+	// format is not specified.
+	CorrectAspectRatio bool
+	// AutoRotate makes the frames be rotated
+	// according to the display matrix of the
+	// stream, so they come out upright. The
+	// size of the format is the size of the
+	// upright frames then. Opening fails if
+	// the pixel format can't be rotated.
+	AutoRotate bool
+}
+
 // VideoStream is a streaming holding
 // video frames.
 type VideoStream struct {
 	baseStream
-	swsCtx    *C.struct_SwsContext
-	rgbaFrame *C.AVFrame
-	bufSize   C.int
-	width     int
-	height    int
+	swsCtx        *C.struct_SwsContext
+	scaledFrame   *C.AVFrame
+	format        VideoFormat
+	width         int
+	height        int
+	srcWidth      int
+	srcHeight     int
+	srcFormat     C.enum_AVPixelFormat
+	sar           C.AVRational
+	rotation      int
+	mirrored      bool
+	colorSpace    ColorSpace
+	colorRange    ColorRange
+	colorSpaceSet bool
+	colorRangeSet bool
 }
 
 // AspectRatio returns the fraction of the video
@@ -32,86 +92,411 @@ func (video *VideoStream) AspectRatio() (int, int) {
 }
 
 // Width returns the width of the video
-// stream frame.
+// stream frame. It changes along with
+// the source if the width of the output
+// format is not specified.
 func (video *VideoStream) Width() int {
 	return video.width
 }
 
 // Height returns the height of the video
-// stream frame.
+// stream frame. It changes along with
+// the source if the height of the output
+// format is not specified.
 func (video *VideoStream) Height() int {
 	return video.height
 }
 
-// OpenDecode opens the video stream for
+// Open opens the video stream for
 // decoding with default parameters.
 func (video *VideoStream) Open() error {
-	return video.OpenDecode(
-		int(video.codecParams.width),
-		int(video.codecParams.height),
-		InterpolationBicubic)
+	return video.OpenDecodeFormat(VideoFormat{})
 }
 
-// OpenDecode opens the video stream for
-// decoding with the specified parameters.
-func (video *VideoStream) OpenDecode(width, height int, alg InterpolationAlgorithm) error {
-	err := video.open()
+// OpenDecode opens the video stream for decoding
+// RGBA frames with the specified parameters.
+//
+// The options are passed to the decoder,
+// e.g. "threads", "skip_frame" or "lowres".
+func (video *VideoStream) OpenDecode(width, height int, alg InterpolationAlgorithm, options ...Options) error {
+	return video.OpenDecodeFormat(VideoFormat{
+		Width:         width,
+		Height:        height,
+		Interpolation: alg,
+		PixelFormat:   PixelFormatRGBA,
+	}, options...)
+}
+
+// OpenDecodeFormat opens the video stream for
+// decoding frames of the specified format.
+//
+// In the native pixel format the frames are
+// neither converted nor scaled, so the size
+// of the format is ignored.
+//
+// The options are passed to the decoder,
+// e.g. "threads", "skip_frame" or "lowres".
+func (video *VideoStream) OpenDecodeFormat(format VideoFormat, options ...Options) error {
+	if format.PixelFormat != PixelFormatNative &&
+		format.PixelFormat.av() == C.AV_PIX_FMT_NONE {
+		return ErrorInvalidValue.wrap(
+			"couldn't use an unknown pixel format")
+	}
+
+	rotation, mirrored := 0, false
+
+	if format.AutoRotate {
+		rotation, mirrored = video.Rotation(), video.Mirrored()
+		err := video.checkRotation(format.PixelFormat,
+			rotation, mirrored)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err := video.open(mergeOptions(options))
 
 	if err != nil {
 		return err
 	}
 
-	video.rgbaFrame = C.av_frame_alloc()
+	if format.Interpolation == 0 {
+		format.Interpolation = InterpolationBicubic
+	}
+
+	// The scaler is created when the first frame
+	// is decoded because the size and the pixel
+	// format of the stream can be unknown yet.
+	video.format = format
+	video.rotation = rotation
+	video.mirrored = mirrored
+
+	video.srcWidth = int(video.codecCtx.width)
+	video.srcHeight = int(video.codecCtx.height)
+	video.srcFormat = video.codecCtx.pix_fmt
+	video.sar = video.codecParams.sample_aspect_ratio
+	crop := video.cropRect(video.srcWidth, video.srcHeight)
+	video.width, video.height = video.
+		outputSize(crop.Dx(), crop.Dy())
+
+	return nil
+}
+
+// SetFilterGraph makes the decoded frames go
+// through the libavfilter graph defined by the
+// description (e.g. "yadif,eq=brightness=0.1")
+// before they are converted to the output
+// format. The empty description removes the
+// filter graph.
+//
+// The size of the output frames follows the
+// graph if the size of the format is not
+// specified.
+func (video *VideoStream) SetFilterGraph(description string) error {
+	return video.setFilterGraph(description)
+}
 
-	if video.rgbaFrame == nil {
-		return fmt.Errorf(
-			"couldn't allocate a new RGBA frame")
+// FilterGraph returns the description of the
+// filter graph of the stream or "" if there's
+// no filter graph.
+func (video *VideoStream) FilterGraph() string {
+	return video.filterGraphDescription()
+}
+
+// Format returns the format the frames
+// are decoded to with the current size
+// of the output frames.
+func (video *VideoStream) Format() VideoFormat {
+	format := video.format
+	format.Width = video.width
+	format.Height = video.height
+
+	return format
+}
+
+// checkRotation reports an error if the frames of
+// the pixel format can't be rotated upright. In the
+// native pixel format the format of the stream is
+// checked if it's known.
+func (video *VideoStream) checkRotation(pixelFormat PixelFormat, angle int, mirror bool) error {
+	format := pixelFormat.av()
+
+	if pixelFormat == PixelFormatNative {
+		format = C.enum_AVPixelFormat(video.codecParams.format)
+	}
+
+	if format == C.AV_PIX_FMT_NONE {
+		return nil
 	}
 
-	video.bufSize = C.av_image_get_buffer_size(
-		C.AV_PIX_FMT_RGBA, C.int(width), C.int(height), 1)
+	return checkRotation(format, angle, mirror)
+}
+
+// quarterTurn returns 'true' if the frames
+// are rotated by 90 or 270 degrees.
+func (video *VideoStream) quarterTurn() bool {
+	return video.rotation == 90 || video.rotation == 270
+}
+
+// scaledSize returns the size of the
+// scaled frames before rotating them.
+func (video *VideoStream) scaledSize() (int, int) {
+	if video.quarterTurn() {
+		return video.height, video.width
+	}
+
+	return video.width, video.height
+}
 
-	if video.bufSize < 0 {
-		return fmt.Errorf(
-			"%d: couldn't get the buffer size", video.bufSize)
+// outputSize returns the size of the upright
+// output frames for the cropped source of
+// the specified size.
+func (video *VideoStream) outputSize(srcWidth, srcHeight int) (int, int) {
+	native := video.format.PixelFormat == PixelFormatNative
+	num, den := int(video.sar.num), int(video.sar.den)
+
+	// Stretch the source to make
+	// its pixels square.
+	if !native && video.format.CorrectAspectRatio &&
+		num > 0 && den > 0 && num != den {
+		srcWidth = (srcWidth*num + den/2) / den
 	}
 
-	buf := (*C.uint8_t)(unsafe.Pointer(
-		C.av_malloc(bufferSize(video.bufSize))))
+	if video.quarterTurn() {
+		srcWidth, srcHeight = srcHeight, srcWidth
+	}
 
-	if buf == nil {
-		return fmt.Errorf(
-			"couldn't allocate an AV buffer")
+	if native {
+		return srcWidth, srcHeight
 	}
 
-	status := C.av_image_fill_arrays(&video.rgbaFrame.data[0],
-		&video.rgbaFrame.linesize[0], buf, C.AV_PIX_FMT_RGBA,
-		C.int(width), C.int(height), 1)
+	width, height := video.format.Width, video.format.Height
+
+	if width <= 0 {
+		width = srcWidth
+	}
+
+	if height <= 0 {
+		height = srcHeight
+	}
+
+	return width, height
+}
+
+// updateSource checks if the size, the pixel
+// format or the sample aspect ratio of the
+// decoded frame differs from the previous
+// one. It returns 'true' if the source has
+// changed.
+func (video *VideoStream) updateSource(frame *C.AVFrame) bool {
+	srcWidth, srcHeight := int(frame.width), int(frame.height)
+	srcFormat := C.enum_AVPixelFormat(frame.format)
+	sar := frame.sample_aspect_ratio
+
+	// Fall back to the aspect ratio
+	// of the stream if the frame
+	// doesn't have one.
+	if sar.num <= 0 || sar.den <= 0 {
+		sar = video.codecParams.sample_aspect_ratio
+	}
+
+	changed := srcWidth != video.srcWidth ||
+		srcHeight != video.srcHeight ||
+		srcFormat != video.srcFormat ||
+		C.av_cmp_q(sar, video.sar) != 0
+
+	video.srcWidth = srcWidth
+	video.srcHeight = srcHeight
+	video.srcFormat = srcFormat
+	video.sar = sar
+
+	return changed
+}
+
+// cropRect returns the crop rectangle of the
+// output format fitted into the source of the
+// specified size.
+func (video *VideoStream) cropRect(srcWidth, srcHeight int) image.Rectangle {
+	bounds := image.Rect(0, 0, srcWidth, srcHeight)
+
+	if video.format.Crop.Empty() {
+		return bounds
+	}
+
+	return video.format.Crop.Intersect(bounds)
+}
+
+// cropFrame crops the decoded frame to the
+// crop rectangle of the output format.
+func (video *VideoStream) cropFrame(frame *C.AVFrame) error {
+	if video.format.Crop.Empty() {
+		return nil
+	}
+
+	width, height := int(frame.width), int(frame.height)
+	crop := video.cropRect(width, height)
+
+	if crop.Empty() {
+		return ErrorInvalidValue.wrap(
+			"couldn't crop the frame outside of its bounds")
+	}
+
+	frame.crop_left = C.size_t(crop.Min.X)
+	frame.crop_top = C.size_t(crop.Min.Y)
+	frame.crop_right = C.size_t(width - crop.Max.X)
+	frame.crop_bottom = C.size_t(height - crop.Max.Y)
+	status := C.av_frame_apply_cropping(frame,
+		C.AV_FRAME_CROP_UNALIGNED)
 
 	if status < 0 {
-		return fmt.Errorf(
-			"%d: couldn't fill the image arrays", status)
+		return newAVError(status,
+			"couldn't crop the frame")
+	}
+
+	return nil
+}
+
+// updateScaler rebuilds the SWS context and
+// the scaled frame for the cropped decoded
+// frame if the source has changed.
+func (video *VideoStream) updateScaler(frame *C.AVFrame, changed bool) error {
+	srcWidth, srcHeight := int(frame.width), int(frame.height)
+	video.width, video.height = video.
+		outputSize(srcWidth, srcHeight)
+
+	if video.format.PixelFormat == PixelFormatNative ||
+		(video.swsCtx != nil && !changed) {
+		return nil
 	}
 
-	video.swsCtx = C.sws_getContext(video.codecCtx.width,
-		video.codecCtx.height, video.codecCtx.pix_fmt,
-		C.int(width), C.int(height),
-		C.AV_PIX_FMT_RGBA, C.int(alg), nil, nil, nil)
+	pixFmt := video.format.PixelFormat.av()
+	width, height := video.scaledSize()
+	video.swsCtx = C.sws_getCachedContext(video.swsCtx,
+		C.int(srcWidth), C.int(srcHeight),
+		C.enum_AVPixelFormat(frame.format),
+		C.int(width), C.int(height), pixFmt,
+		C.int(video.format.Interpolation), nil, nil, nil)
 
 	if video.swsCtx == nil {
-		return fmt.Errorf(
+		return ErrorInvalidValue.wrap(
 			"couldn't create an SWS context")
 	}
 
-	video.width = width
-	video.height = height
+	if video.scaledFrame == nil ||
+		int(video.scaledFrame.width) != width ||
+		int(video.scaledFrame.height) != height {
+		err := video.allocScaledFrame(pixFmt)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return video.applyColorDetails()
+}
+
+// allocScaledFrame allocates the frame the
+// decoded frames are scaled to.
+func (video *VideoStream) allocScaledFrame(pixFmt C.enum_AVPixelFormat) error {
+	C.av_frame_free(&video.scaledFrame)
+	video.scaledFrame = C.av_frame_alloc()
+
+	if video.scaledFrame == nil {
+		return ErrorNoMemory.wrap(
+			"couldn't allocate a new frame for scaling")
+	}
+
+	width, height := video.scaledSize()
+	video.scaledFrame.format = C.int(pixFmt)
+	video.scaledFrame.width = C.int(width)
+	video.scaledFrame.height = C.int(height)
+	status := C.av_frame_get_buffer(video.scaledFrame, 0)
+
+	if status < 0 {
+		C.av_frame_free(&video.scaledFrame)
+
+		return newAVError(status,
+			"couldn't allocate the buffer of the scaled frame")
+	}
+
+	return nil
+}
+
+// applyColorDetails sets the color space and
+// the color range of the decoded frames for
+// the SWS context.
+//
+// The untagged HD video is considered BT.709,
+// and the rest is considered BT.601. The RGB
+// output is full range unless the format
+// specifies the range, and the YUV one keeps
+// the source values.
+func (video *VideoStream) applyColorDetails() error {
+	if video.swsCtx == nil {
+		return nil
+	}
+
+	space := video.ColorSpace()
+
+	if space == ColorSpaceUnspecified {
+		space = ColorSpaceBT470BG
+
+		if video.srcHeight >= 720 {
+			space = ColorSpaceBT709
+		}
+	}
+
+	srcRange := C.int(0)
+
+	if video.ColorRange() == ColorRangeFull {
+		srcRange = 1
+	}
+
+	dstRange := srcRange
+	coefficients := C.sws_getCoefficients(C.int(space))
+	output := video.format.PixelFormat.av()
+	rgb := C.av_pix_fmt_desc_get(output).
+		flags&C.AV_PIX_FMT_FLAG_RGB != 0
+
+	if rgb {
+		dstRange = 1
+
+		if video.format.ColorRange == ColorRangeLimited {
+			dstRange = 0
+		}
+	}
+
+	status := C.sws_setColorspaceDetails(video.swsCtx,
+		coefficients, srcRange, coefficients, dstRange,
+		0, 1<<16, 1<<16)
+
+	// libswscale refuses the details of YUV to YUV
+	// conversions, but it keeps the ranges anyway.
+	if status < 0 && rgb {
+		return ErrorInvalidValue.wrap(
+			"couldn't set the color space details")
+	}
 
 	return nil
 }
 
 // ReadFrame reads the next frame from the stream.
 func (video *VideoStream) ReadFrame() (Frame, bool, error) {
-	return video.ReadVideoFrame()
+	frame, ok, err := video.ReadVideoFrame()
+
+	if frame == nil {
+		return nil, ok, err
+	}
+
+	return frame, ok, err
+}
+
+// Flush drains the video decoder and returns
+// the frames left in it after the end of the
+// media has been reached.
+func (video *VideoStream) Flush() ([]Frame, error) {
+	return video.flush(video.ReadFrame)
 }
 
 // ReadVideoFrame reads the next video frame
@@ -132,24 +517,85 @@ func (video *VideoStream) ReadVideoFrame() (*VideoFrame, bool, error) {
 		return nil, false, nil
 	}
 
-	C.sws_scale(video.swsCtx, &video.frame.data[0],
-		&video.frame.linesize[0], 0,
-		video.codecCtx.height,
-		&video.rgbaFrame.data[0],
-		&video.rgbaFrame.linesize[0])
+	changed := video.updateSource(video.frame)
+	err = video.cropFrame(video.frame)
 
-	data := C.GoBytes(unsafe.
-		Pointer(video.rgbaFrame.data[0]),
-		video.bufSize)
-	frame := newVideoFrame(video, int64(video.frame.pts),
-		int(video.frame.coded_picture_number),
-		int(video.frame.display_picture_number),
-		int(video.codecCtx.width), int(video.codecCtx.height), data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = video.updateScaler(video.frame, changed)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	output := video.frame
+
+	if video.format.PixelFormat != PixelFormatNative {
+		C.sws_scale(video.swsCtx, &video.frame.data[0],
+			&video.frame.linesize[0], 0,
+			video.frame.height,
+			&video.scaledFrame.data[0],
+			&video.scaledFrame.linesize[0])
+
+		output = video.scaledFrame
+	}
+
+	data, err := copyImage(output)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	pixFmt := C.enum_AVPixelFormat(output.format)
+	data, width, height, err := rotateImage(pixFmt,
+		int(output.width), int(output.height),
+		data, video.rotation, video.mirrored)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	indCoded, indDisplay := video.pictureNumbers()
+	frame := newVideoFrame(video, video.frameTimestamp(),
+		int64(video.frame.duration), indCoded, indDisplay,
+		width, height, pixFmt, data)
+	frame.formatChanged = changed
 
 	return frame, true, nil
 }
 
+// copyImage copies the image of the
+// frame to a new contiguous buffer.
+func copyImage(frame *C.AVFrame) ([]byte, error) {
+	size := C.av_image_get_buffer_size(
+		C.enum_AVPixelFormat(frame.format),
+		frame.width, frame.height, 1)
+
+	if size < 0 {
+		return nil, newAVError(size,
+			"couldn't get the image buffer size")
+	}
+
+	data := make([]byte, size)
+	status := C.av_image_copy_to_buffer(
+		(*C.uint8_t)(unsafe.Pointer(&data[0])), size,
+		&frame.data[0], &frame.linesize[0],
+		C.enum_AVPixelFormat(frame.format),
+		frame.width, frame.height, 1)
+
+	if status < 0 {
+		return nil, newAVError(status,
+			"couldn't copy the image")
+	}
+
+	return data, nil
+}
+
 // Close closes the video stream for decoding.
+//
+// It's safe to call it several times.
 func (video *VideoStream) Close() error {
 	err := video.close()
 
@@ -157,8 +603,7 @@ func (video *VideoStream) Close() error {
 		return err
 	}
 
-	C.av_free(unsafe.Pointer(video.rgbaFrame))
-	video.rgbaFrame = nil
+	C.av_frame_free(&video.scaledFrame)
 	C.sws_freeContext(video.swsCtx)
 	video.swsCtx = nil
 
@@ -1,36 +1,80 @@
 package reisen
 
+// #cgo pkg-config: libavutil
+// #include <libavutil/pixfmt.h>
+import "C"
 import "image"
 
 // VideoFrame is a single frame
 // of a video stream.
 type VideoFrame struct {
 	baseFrame
-	img *image.RGBA
+	img           image.Image
+	data          []byte
+	width         int
+	height        int
+	formatName    string
+	formatChanged bool
 }
 
-// Data returns a byte slice of RGBA
-// pixels of the frame image.
+// Data returns a byte slice of the pixels
+// of the frame image. The planes of the
+// planar formats follow each other.
 func (frame *VideoFrame) Data() []byte {
-	return frame.img.Pix
+	return frame.data
 }
 
-// Image returns the RGBA image of the frame.
-func (frame *VideoFrame) Image() *image.RGBA {
+// Image returns the image of the frame. Its type
+// matches the pixel format of the stream: e.g.
+// *image.RGBA for RGBA and *image.YCbCr for
+// YUV420P.
+//
+// For the native pixel format it's nil if
+// the format of the decoder has no matching
+// image type.
+func (frame *VideoFrame) Image() image.Image {
 	return frame.img
 }
 
+// Width returns the width
+// of the frame image.
+func (frame *VideoFrame) Width() int {
+	return frame.width
+}
+
+// Height returns the height
+// of the frame image.
+func (frame *VideoFrame) Height() int {
+	return frame.height
+}
+
+// PixelFormatName returns the libAV name of
+// the pixel format of the frame image, e.g.
+// "yuv420p" or "rgba".
+func (frame *VideoFrame) PixelFormatName() string {
+	return frame.formatName
+}
+
+// FormatChanged returns 'true' if the size
+// or the pixel format of the decoded picture
+// differs from the one of the previous frame
+// (e.g. in concatenated or live sources).
+func (frame *VideoFrame) FormatChanged() bool {
+	return frame.formatChanged
+}
+
 // newVideoFrame returns a newly created video frame.
-func newVideoFrame(stream Stream, pts int64, indCoded, indDisplay, width, height int, pix []byte) *VideoFrame {
-	upLeft := image.Point{0, 0}
-	lowRight := image.Point{width, height}
-	img := image.NewRGBA(image.Rectangle{upLeft, lowRight})
+func newVideoFrame(stream Stream, pts, duration int64, indCoded, indDisplay, width, height int, format C.enum_AVPixelFormat, data []byte) *VideoFrame {
 	frame := new(VideoFrame)
 
-	img.Pix = pix
 	frame.stream = stream
 	frame.pts = pts
-	frame.img = img
+	frame.duration = duration
+	frame.img = newImage(format, width, height, data)
+	frame.data = data
+	frame.width = width
+	frame.height = height
+	frame.formatName = pixelFormatName(format)
 	frame.indexCoded = indCoded
 	frame.indexDisplay = indDisplay
 